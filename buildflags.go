@@ -0,0 +1,66 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strconv"
+)
+
+// goBuildFlags are the flags forwarded to "go build", in the order given on the command line.
+var goBuildFlags []string
+
+// registerBuildFlags registers the flags that are forwarded to "go build".
+// See "go help build".
+func registerBuildFlags() {
+	for _, f := range []struct{ name, usage string }{
+		{"tags", "comma-separated list of build tags (go build -tags)."},
+		{"gcflags", "arguments to pass on each go tool compile invocation (go build -gcflags)."},
+		{"ldflags", "arguments to pass on each go tool link invocation (go build -ldflags)."},
+		{"pgo", "file path of the profile for profile-guided optimization (go build -pgo)."},
+	} {
+		flag.Func(f.name, f.usage, func(value string) error {
+			// "go build" doesn't run in the current directory
+			if f.name == "pgo" && value != "auto" && value != "off" {
+				var err error
+				if value, err = filepath.Abs(value); err != nil {
+					return err
+				}
+			}
+			goBuildFlags = append(goBuildFlags, "-"+f.name+"="+value)
+			return nil
+		})
+	}
+	for _, f := range []struct{ name, usage string }{
+		{"race", "enable data race detection (go build -race)."},
+		{"msan", "enable interoperation with memory sanitizer (go build -msan)."},
+		{"asan", "enable interoperation with address sanitizer (go build -asan)."},
+		{"cover", "enable code coverage instrumentation (go build -cover). Set GOCOVERDIR to collect the data."},
+	} {
+		flag.BoolFunc(f.name, f.usage, func(value string) error {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			if enabled {
+				goBuildFlags = append(goBuildFlags, "-"+f.name)
+			}
+			return nil
+		})
+	}
+}
@@ -21,22 +21,69 @@
 // The code, given either as the first argument or on stdin, is wrapped as
 // the body of a main() function in a main package, and executed with "go run".
 //
+// The code can also be read from a script file with -f. Such a file may start
+// with a "#!/usr/bin/env goeval" line and //goeval:<flag> [<value>] directives.
+//
+// Top-level declarations (functions, types...) can be added with -d.
+//
+// With -p, the code is instead an expression and its value is printed, like
+// [fmt.Println] does.
+//
+// With -n, the code is run for each line of input, like "perl -n". -l also prints
+// the line after each iteration.
+//
 // Imports are implicit (they are usually resolved automatically thanks to
 // [goimports]) but they can be explicitely specified using -i.
 // If at least one package import is given with a version (import-path@version),
 // a full Go module is assembled, and imports without version are resolved
 // as the latest version available in the local Go module cache (GOMODCACHE).
+// The version can also be a query such as "latest" (-v shows the selected versions
+// and -lock saves them for later runs).
+// A module can be imported from a local directory with -i module-path=>./dir.
+// -offline resolves modules only from the module cache.
+// With -use, the code is built in a Go workspace (go.work) with the modules
+// from the given local directories.
 //
 // In GOPATH mode (the default), the local Go context is involved only if the current
 // directory happens to be in GOPATH and the package is imported.
 // In Go module mode, the local Go context (go.mod, .go source files) is completely
 // ignored for resolving imports and compiling the snippet.
+// With -workspace, the module is kept in the user cache directory and reused by
+// later runs: "go get" is skipped if the set of modules is unchanged.
+//
+// With -mod=here, the code is built inside the Go module (or workspace) of the
+// current directory, so it can import the packages of that module.
+//
+// -txtar runs a multi-files program from a txtar archive (Go files, go.mod, go.sum,
+// data files) such as produced by -E or [the Go Playground].
 //
 // -play runs the code in the sandbox of [the Go Playground] instead of the local
 // machine and replays the output.
 //
 // -share posts the code for storage on [the Go Playground] and displays the URL.
 //
+// -fetch retrieves a snippet shared on [the Go Playground] to run it locally.
+//
+// Build flags -tags, -race, -msan, -asan, -gcflags, -ldflags, -cover and -pgo
+// are forwarded to "go build".
+//
+// -goos and -goarch build for another platform. The executable is then run
+// through a runner (-exec, go_$GOOS_$GOARCH_exec or $GOROOT/lib/wasm).
+//
+// With -test or -bench, the code is the body of a test or benchmark function run
+// with "go test".
+//
+// With a comma-separated list of go commands or Go toolchains, -go runs the code
+// with each of them and compares the outputs.
+//
+// -timeout limits the duration of each phase (resolution of modules, build and run).
+// On expiry, the processes are killed and the exit code is 124.
+//
+// -repl starts an interactive session where each input line is added to the program,
+// which is run again to show the new output.
+//
+// The engine of goeval is the package [github.com/dolmen-go/goeval/eval].
+//
 // 🚀 Quick Start
 //
 //	go install github.com/dolmen-go/goeval@latest
@@ -0,0 +1,104 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/txtar"
+)
+
+// FromArchive prepares the multi-files program contained in a txtar archive (Go files,
+// go.mod, go.sum, go.work and data files) to be built and run like an assembled snippet.
+// The program runs from the directory where the archive is extracted, so data files are
+// available. The options about the assembly of a snippet are ignored.
+// With [Options.Offline], the modules are resolved from the module cache (the "resolve"
+// phase of [Options.Timeout]).
+// [Program.Close] must be called to remove the extracted files.
+func FromArchive(ctx context.Context, ar *txtar.Archive, opts *Options) (_ *Program, err error) {
+	p, err := newProgram(opts)
+	if err != nil {
+		return nil, err
+	}
+	p.archive = ar
+	ctx, cancel := p.phase(ctx, "resolve")
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "goeval*")
+	if err != nil {
+		return nil, err
+	}
+	p.cleanups = append(p.cleanups, func() {
+		if err := os.RemoveAll(dir); err != nil {
+			p.warn("RemoveAll(%q): %v", dir, err)
+		}
+	})
+	defer func() {
+		if err != nil {
+			err = phaseErr(ctx, err)
+			p.Close()
+		}
+	}()
+
+	if err := extractArchive(ar, dir); err != nil {
+		return nil, err
+	}
+
+	env := p.opts.targetEnv(p.env)
+	if _, err := os.Stat(filepath.Join(dir, "go.work")); err == nil {
+		// Go workspace (-use): -mod=mod is not allowed
+		env = append(withoutModMod(env), "GO111MODULE=on", "GOWORK="+filepath.Join(dir, "go.work"))
+	} else if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		// Let "go build" complete go.sum if necessary
+		env = append(withModMod(env), "GO111MODULE=on", "GOWORK=off")
+	} else {
+		env = append(env, "GO111MODULE=off")
+	}
+	p.env = env
+
+	if p.opts.Offline && lookupEnv(env, "GO111MODULE") == "on" {
+		gomodcache, err := p.getGOMODCACHE(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// Resolve all modules from the module cache, like Assemble
+		p.env = append(p.env, "GOPROXY="+offlineProxy(gomodcache), "GOSUMDB=off")
+	}
+
+	// Run from the directory of the archive to give access to data files
+	p.dir = dir
+	p.srcFilename = "."
+	p.buildDir = dir
+	p.runDir = dir
+	return p, nil
+}
+
+// extractArchive writes the files of the archive in dir.
+func extractArchive(ar *txtar.Archive, dir string) error {
+	for _, f := range ar.Files {
+		path := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, f.Data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
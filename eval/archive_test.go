@@ -0,0 +1,59 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+func TestFromArchiveGOFLAGS(t *testing.T) {
+	ar := txtar.Parse([]byte("-- go.mod --\nmodule example.com/m\n-- main.go --\npackage main\nfunc main() {}\n"))
+	for _, tc := range []struct {
+		goflags, expected string
+	}{
+		{"", "-mod=mod"},
+		{"-tags=foo -trimpath", "-tags=foo -trimpath -mod=mod"},
+		{"-mod=readonly -tags=foo", "-tags=foo -mod=mod"},
+	} {
+		p, err := FromArchive(t.Context(), ar, &Options{Env: []string{"GOFLAGS=" + tc.goflags}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lookupEnv(p.env, "GOFLAGS"); got != tc.expected {
+			t.Errorf("GOFLAGS=%q: got %q, expected %q", tc.goflags, got, tc.expected)
+		}
+		p.Close()
+	}
+}
+
+func TestFromArchiveOffline(t *testing.T) {
+	ar := txtar.Parse([]byte("-- go.mod --\nmodule example.com/m\n-- main.go --\npackage main\nfunc main() {}\n"))
+	p, err := FromArchive(t.Context(), ar, &Options{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if got := lookupEnv(p.env, "GOPROXY"); !strings.HasPrefix(got, "file://") {
+		t.Errorf("GOPROXY: got %q, expected the module cache", got)
+	}
+	if got := lookupEnv(p.env, "GOSUMDB"); got != "off" {
+		t.Errorf("GOSUMDB: got %q, expected off", got)
+	}
+}
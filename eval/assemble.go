@@ -0,0 +1,702 @@
+/*
+   Copyright 2019-2025 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/modfile"
+	goimp "golang.org/x/tools/imports"
+	"golang.org/x/tools/txtar"
+
+	"github.com/dolmen-go/goeval/internal/procgroup"
+)
+
+// Assemble assembles the Go source of the snippet. In Go module mode, the module is
+// created and its dependencies are resolved (the "resolve" phase of [Options.Timeout]).
+// [Program.Close] must be called to remove the temporary files.
+func Assemble(ctx context.Context, opts *Options) (_ *Program, err error) {
+	p, err := newProgram(opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := p.phase(ctx, "resolve")
+	defer cancel()
+	defer func() {
+		if err != nil {
+			err = phaseErr(ctx, err)
+			p.Close()
+		}
+	}()
+	opts = &p.opts
+
+	imports := imports{
+		packages:   map[string]string{},
+		onlySemVer: true,
+	}
+	for _, imp := range opts.Imports {
+		if err := imports.Set(imp); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Test && opts.Bench {
+		return nil, errors.New("Test and Bench are exclusive")
+	}
+
+	var useDirs []string // nil if not in a Go workspace
+	for _, dir := range opts.Use {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		useDirs = append(useDirs, dir)
+	}
+
+	moduleMode := imports.modules != nil || useDirs != nil
+
+	if imports.replaces != nil && !moduleMode {
+		return nil, errors.New("replacement of a module (-i path=>module@version) requires module mode (-i import-path@version)")
+	}
+
+	if opts.Workspace != "" && !moduleMode {
+		return nil, errors.New("flag -workspace requires module mode (-i import-path@version)")
+	}
+
+	if opts.ModHere {
+		if useDirs != nil {
+			return nil, errors.New("flag -mod=here excludes -use")
+		}
+		if moduleMode {
+			return nil, errors.New("flag -mod=here excludes imports with a version")
+		}
+		// The build depends on the whole module
+		p.noCache = true
+	}
+
+	// Environment of goimports: see goimportsEnv
+	var goimportsEnv []string
+	if opts.ModHere || useDirs != nil {
+		p.env = withoutModMod(p.env)
+		goimportsEnv = append(goimportsEnv, "GOFLAGS="+lookupEnv(p.env, "GOFLAGS"))
+	}
+
+	env := opts.targetEnv(p.env)
+	if moduleMode || opts.ModHere {
+		env = append(env, "GO111MODULE=on")
+	} else {
+		// Run in GOPATH mode, ignoring any code in the current directory
+		env = append(env, "GO111MODULE=off")
+	}
+	p.env = env
+
+	var dir string
+
+	if opts.ModHere {
+		if _, err := p.getGOMOD(ctx); err != nil {
+			return nil, err
+		}
+		if opts.Offline {
+			gomodcache, err := p.getGOMODCACHE(ctx)
+			if err != nil {
+				return nil, err
+			}
+			p.env = append(p.env, "GOPROXY="+offlineProxy(gomodcache), "GOSUMDB=off")
+		}
+	}
+
+	if moduleMode {
+		// "go get" is not yet as smart as we want, so let's help
+		// https://go.dev/issue/43646
+		preferCache := imports.onlySemVer
+		var gomodcache string
+		if preferCache || opts.Offline {
+			var err error
+			gomodcache, err = p.getGOMODCACHE(ctx)
+			if opts.Offline && err != nil {
+				return nil, err
+			}
+			preferCache = preferCache && err == nil
+		}
+
+		// Paths of the modules used in the Go workspace
+		var usedModules []string
+		for _, dir := range useDirs {
+			b, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+			if err != nil {
+				return nil, err
+			}
+			usedModules = append(usedModules, modfile.ModulePath(b))
+		}
+
+		var gogetArgs []string
+		gogetArgs = append(gogetArgs, "get", "--")
+		for mod, ver := range imports.modules {
+			gogetArgs = append(gogetArgs, mod+"@"+ver)
+		}
+		for mod, ver := range imports.proxyModules() {
+			if preferCache {
+				// Keep preferCache as long as we find modules in the cache.
+				preferCache = inModCache(gomodcache, mod, ver)
+			}
+		}
+		for _, path := range imports.packages {
+			if _, seen := imports.modules[path]; !seen && !imports.replacedByDir(path) && !slices.ContainsFunc(usedModules, func(mod string) bool {
+				return path == mod || strings.HasPrefix(path, mod+"/")
+			}) {
+				if ver := imports.moduleVersion(path); opts.Offline && ver != "" {
+					// Without network, "go get" can't query the latest version:
+					// use the version of the module imported with -i
+					path += "@" + ver
+				}
+				gogetArgs = append(gogetArgs, path)
+			}
+		}
+		// Stable order for the workspace stamp
+		slices.Sort(gogetArgs[2:])
+		request := slices.Clone(gogetArgs[2:])
+		for _, old := range slices.Sorted(maps.Keys(imports.replaces)) {
+			request = append(request, old+"=>"+imports.replaces[old])
+		}
+		for _, dir := range useDirs {
+			request = append(request, "use "+dir)
+		}
+
+		// upToDate is set if go.mod and go.sum of the workspace are already resolved.
+		var upToDate bool
+		if opts.Workspace == "" {
+			if dir, err = os.MkdirTemp("", "goeval*"); err != nil {
+				return nil, err
+			}
+			p.cleanups = append(p.cleanups, func() { os.Remove(dir) })
+		} else {
+			if dir, upToDate, p.unlock, err = openWorkspace(ctx, opts.Workspace, request); err != nil {
+				return nil, fmt.Errorf("workspace: %w", err)
+			}
+			p.cleanups = append(p.cleanups, p.unlockWorkspace)
+		}
+		// Version queries (@latest, @master...) must be resolved again
+		upToDate = upToDate && imports.onlySemVer
+
+		var lock *txtar.Archive
+		if opts.Lock != "" {
+			if lock, err = readLock(opts.Lock, request); err != nil {
+				return nil, err
+			}
+		}
+
+		if opts.Workspace != "" && (!upToDate || lock != nil) {
+			// go.mod is updated below: if "go get" fails, the next run must call it again
+			if err := invalidateWorkspace(dir); err != nil {
+				return nil, fmt.Errorf("workspace: %w", err)
+			}
+		}
+
+		// A constant module name, as the build must be reproducible for the cache
+		const moduleName = "goeval"
+
+		gomod := dir + "/go.mod"
+		if lock != nil {
+			// The resolution is in the lock file
+			if err := extractArchive(lock, dir); err != nil {
+				return nil, err
+			}
+			upToDate = true
+			if opts.Workspace != "" {
+				if err := saveWorkspace(dir, request); err != nil {
+					return nil, fmt.Errorf("workspace: %w", err)
+				}
+			}
+		} else if !upToDate {
+			// The go.mod of an existing workspace is updated: "go get" will update it further
+			if err := writeGoMod(gomod, moduleName, imports.replaces); err != nil {
+				return nil, fmt.Errorf("go.mod: %w", err)
+			}
+		}
+		if opts.Workspace == "" {
+			p.cleanups = append(p.cleanups, func() { os.Remove(gomod) })
+		}
+
+		if useDirs != nil {
+			gowork := dir + "/go.work"
+			os.Remove(gowork) // From a previous run in the workspace
+			cmd := procgroup.Command(ctx, opts.GoCmd, append([]string{"work", "init", "."}, useDirs...)...)
+			cmd.Env = append(p.env, "GOWORK="+gowork)
+			cmd.Dir = dir
+			cmd.Stderr = p.stderr
+			if err := p.run(cmd); err != nil {
+				return nil, p.failed("go.work", err)
+			}
+			p.cleanups = append(p.cleanups, func() {
+				os.Remove(gowork)
+				os.Remove(gowork + ".sum")
+			})
+			p.env = append(p.env, "GOWORK="+gowork)
+			goimportsEnv = append(goimportsEnv, "GOWORK="+gowork)
+			// "go get" may not be run: set the go version of go.mod like "go work init" did for go.work
+			if err := setGoVersion(gomod, gowork); err != nil {
+				return nil, fmt.Errorf("go.mod: %w", err)
+			}
+		} else {
+			// Ignore any go.work given by the user's environment
+			p.env = append(p.env, "GOWORK=off")
+		}
+
+		if opts.Offline {
+			// Resolve all modules from the module cache.
+			// Checksums have been verified when the modules were downloaded.
+			p.env = append(p.env, "GOPROXY="+offlineProxy(gomodcache), "GOSUMDB=off")
+		} else if preferCache {
+			// As we found all modules in the cache, tell "go get" and "go run" to not use the proxy.
+			// See https://go.dev/issue/43646
+			p.env = append(p.env, "GOPROXY=off")
+		}
+
+		// Nothing to get if all packages come from the Go workspace
+		if !upToDate && len(gogetArgs) > 2 {
+			cmd := procgroup.Command(ctx, opts.GoCmd, gogetArgs...)
+			cmd.Env = p.env
+			cmd.Dir = dir
+			cmd.Stdin = nil
+			cmd.Stdout = p.stdout
+			// go get is too verbose :(
+			cmd.Stderr = nil
+			var stderr bytes.Buffer
+			if opts.Verbose {
+				cmd.Stderr = p.stderr
+			} else if opts.Offline {
+				cmd.Stderr = &stderr
+			}
+			if err = p.run(cmd); err != nil {
+				if opts.Offline {
+					if missing := missingModules(gomodcache, imports.proxyModules()); len(missing) > 0 {
+						return nil, fmt.Errorf("offline: modules missing from the module cache %s:\n\t%s", gomodcache, strings.Join(missing, "\n\t"))
+					}
+					p.stderr.Write(stderr.Bytes())
+				}
+				return nil, p.failed("go get failure", err)
+			}
+			if opts.Workspace != "" {
+				if err := saveWorkspace(dir, request); err != nil {
+					return nil, fmt.Errorf("workspace: %w", err)
+				}
+			}
+		}
+		if opts.Workspace == "" {
+			p.cleanups = append(p.cleanups, func() { os.Remove(dir + "/go.sum") })
+		}
+
+		if opts.Lock != "" && lock == nil {
+			if err := writeLock(opts.Lock, dir, request); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Verbose {
+			if err := reportVersions(p.stderr, gomod, imports.modules); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.dir = dir
+
+	var (
+		src        bytes.Buffer
+		injectArgs bool // inject our arguments into os.Args in the program source
+	)
+
+	// If sending to the Go Playground, export GOEXPERIMENT as a comment
+	if opts.Playground {
+		const alphaNum = "abcdefghijklmnopqrstuvwxyz0123456789"
+		const alphaNumComma = alphaNum + ","
+		if exp := lookupEnv(p.env, "GOEXPERIMENT"); exp != "" && // Not empty
+			strings.Trim(exp, ",") == exp && // No leading or trailing commas
+			strings.Trim(exp, alphaNumComma) == "" { // only lower case alpha num and comma
+			src.WriteString("// GOEXPERIMENT=")
+			src.WriteString(exp)
+			src.WriteString("\n\n")
+		}
+
+		injectArgs = len(opts.Args) > 0
+		if injectArgs {
+			// We need the os package to patch os.Args
+			imports.Set("os")
+		}
+	}
+
+	code := opts.Code
+	lineLoop := opts.Lines || opts.PrintLines
+
+	if opts.Print {
+		// Packages used by goevalPrint
+		imports.Set("fmt,os,reflect")
+	}
+	if p.testBuild() {
+		imports.Set("testing")
+	}
+	// With Bench, the code is run in a b.Loop() loop, unless it handles the loop itself
+	benchLoop := opts.Bench && !usesBenchLoop(code)
+
+	// With Lines, the input for the Go Playground is read now and embedded in the source
+	var lineInput []byte
+	if lineLoop {
+		// Packages used by goevalEachLine
+		imports.Set("bufio,fmt,io,os,strings")
+
+		if opts.Playground {
+			var err error
+			if lineInput, err = readInput(opts.Args, opts.Stdin); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	src.WriteString("package main\n")
+	for alias, path := range imports.packages {
+		if len(alias) > 2 && alias[1] == ' ' {
+			switch alias[0] {
+			case '.', '_':
+				alias = alias[:1]
+			case ' ': // no alias
+				fmt.Fprintf(&src, "import %q\n", path)
+				continue
+			}
+		}
+		fmt.Fprintf(&src, "import %s %q\n", alias, path)
+	}
+	if injectArgs {
+		fmt.Fprintf(&src, "func init() { os.Args = append(os.Args[:1], %#v...) }\n\n", opts.Args)
+	}
+	if opts.Print {
+		src.WriteString(printFunc)
+	}
+	if lineLoop {
+		src.WriteString(scanLinesFunc)
+		if opts.Playground {
+			src.WriteString(eachLineInputFunc)
+			fmt.Fprintf(&src, "const goevalInput = %q\n\n", lineInput)
+		} else {
+			src.WriteString(eachLineFunc)
+		}
+	}
+	for i, decl := range opts.Decls {
+		if !opts.Playground {
+			fmt.Fprintf(&src, "//line -d#%d:1\n", i+1)
+		}
+		src.WriteString(decl)
+		src.WriteString("\n\n")
+	}
+	switch {
+	case opts.Test:
+		src.WriteString("func TestGoeval(t *testing.T) {\n")
+	case opts.Bench:
+		src.WriteString("func BenchmarkGoeval(b *testing.B) {\n")
+		if benchLoop {
+			src.WriteString("for b.Loop() {\n")
+		}
+	default:
+		src.WriteString("func main() {\n")
+	}
+	if lineLoop {
+		src.WriteString("goevalEachLine(func(line string, lineNum int, fields []string) {\n")
+		if opts.PrintLines {
+			src.WriteString("defer func() { fmt.Println(line) }()\n")
+		}
+	}
+	if opts.Print {
+		src.WriteString("goevalPrint(\n")
+		// The expression becomes the argument list of goevalPrint
+		code = printArgs(code)
+	}
+	if !opts.Playground {
+		src.WriteString("//line " + opts.CodePos + "\n")
+	}
+	// Line of the code in src, for Format error messages
+	codeLine := bytes.Count(src.Bytes(), []byte{'\n'}) + 1
+	src.WriteString(code)
+	if lineLoop {
+		src.WriteString("\n})")
+	}
+	if benchLoop {
+		src.WriteString("\n}")
+	}
+	src.WriteString("\n}\n")
+
+	// The source file, in the module directory in module mode
+	pattern := "*.go"
+	if p.testBuild() {
+		pattern = "*_test.go"
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	p.srcFilename = f.Name()
+	p.cleanups = append(p.cleanups, func() { os.Remove(p.srcFilename) })
+
+	switch {
+	case opts.Format != nil:
+		p.source, err = opts.Format(ctx, src.Bytes(), codeLine)
+	case opts.Goimports == "":
+		var filename string // filename is used to locate the relevant go.mod
+		if imports.packages != nil {
+			filename = p.srcFilename
+		}
+		if opts.ModHere {
+			// Resolve imports from the module of the working directory
+			filename = filepath.Join(opts.Dir, "goeval.go")
+		} else if useDirs != nil {
+			// Resolve imports from the Go workspace
+			filename = filepath.Join(dir, "goeval.go")
+		}
+		err = withEnv(goimportsEnv, func() (err error) {
+			p.source, err = goimp.Process(filename, src.Bytes(), &goimp.Options{
+				Fragment:   false,
+				AllErrors:  false,
+				Comments:   true,
+				TabIndent:  true,
+				TabWidth:   8,
+				FormatOnly: false,
+			})
+			return
+		})
+	case opts.Goimports == "off":
+		p.source = src.Bytes()
+	default:
+		var out bytes.Buffer
+		cmd := procgroup.Command(ctx, opts.Goimports)
+		cmd.Env = p.env
+		cmd.Dir = dir
+		cmd.Stdin = &src
+		cmd.Stdout = &out
+		cmd.Stderr = p.stderr
+		err = p.run(cmd)
+		p.source = out.Bytes()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(p.srcFilename, p.source, 0o600); err != nil {
+		return nil, err
+	}
+
+	p.buildDir = dir
+	if opts.ModHere {
+		// The code appears as a file of the working directory
+		filename := filepath.Join(opts.Dir, "goeval-"+filepath.Base(p.srcFilename))
+		if p.overlay, err = writeOverlay(dir, filename, p.srcFilename); err != nil {
+			return nil, err
+		}
+		p.cleanups = append(p.cleanups, func() { os.Remove(p.overlay) })
+		p.srcFilename = filename
+		p.buildDir = opts.Dir
+	}
+
+	return p, nil
+}
+
+// envMu serializes the calls of the goimports library, as withEnv changes the environment
+// of the process.
+var envMu sync.Mutex
+
+// printArgs returns the code as the argument list of a call, closed by a parenthesis on a
+// new line. A comma is inserted after the last token (unless it is a comma), before any
+// trailing comment, to avoid the insertion of a semicolon at the end of the line.
+func printArgs(code string) string {
+	src := []byte(code)
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+	end, last := len(src), token.ILLEGAL
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.COMMENT || tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		end, last = file.Offset(pos)+len(lit), tok
+	}
+	if last == token.COMMA {
+		return code + "\n)"
+	}
+	return code[:end] + "," + code[end:] + "\n)"
+}
+
+// withEnv runs f with the environment variables (name=value) set in the environment of the
+// process, for the goimports library which doesn't take an environment.
+// The environment is restored after.
+func withEnv(env []string, f func() error) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if old, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Setenv(name, value)
+	}
+	return f()
+}
+
+// printFunc is the source of the function that wraps the expression of [Options.Print].
+//
+// The values are printed like [fmt.Println]. If the last value is a non-nil error,
+// only the error is printed (on stderr) and the program exits with status 1.
+// A trailing nil value is dropped if there are multiple values (case of a (T, error) result).
+const printFunc = `func goevalPrint(v ...any) {
+	if n := len(v); n > 0 {
+		switch last := v[n-1].(type) {
+		case error:
+			// A nil pointer in an error is a nil error
+			if rv := reflect.ValueOf(last); rv.Kind() != reflect.Pointer || !rv.IsNil() {
+				fmt.Fprintln(os.Stderr, last)
+				os.Exit(1)
+			}
+			if n > 1 {
+				v = v[:n-1]
+			}
+		case nil:
+			if n > 1 {
+				v = v[:n-1]
+			}
+		}
+	}
+	fmt.Println(v...)
+}
+
+`
+
+// scanLinesFunc is the source of the function that runs the -n loop on a reader.
+const scanLinesFunc = `func goevalScanLines(r io.Reader, lineNum int, f func(line string, lineNum int, fields []string)) int {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		lineNum++
+		line := s.Text()
+		f(line, lineNum, strings.Fields(line))
+	}
+	if err := s.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return lineNum
+}
+
+`
+
+// eachLineFunc is the source of the function that runs the -n loop on the files
+// given as arguments, or stdin. Like in Perl, "-" is stdin.
+const eachLineFunc = `func goevalEachLine(f func(line string, lineNum int, fields []string)) {
+	files := os.Args[1:]
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var lineNum int
+	for _, name := range files {
+		if name == "-" {
+			lineNum = goevalScanLines(os.Stdin, lineNum, f)
+			continue
+		}
+		r, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		lineNum = goevalScanLines(r, lineNum, f)
+		r.Close()
+	}
+}
+
+`
+
+// eachLineInputFunc is the source of the function that runs the -n loop on input
+// embedded in the source as constant goevalInput.
+// This is used for the Go Playground where neither stdin nor local files are available.
+const eachLineInputFunc = `func goevalEachLine(f func(line string, lineNum int, fields []string)) {
+	goevalScanLines(strings.NewReader(goevalInput), 0, f)
+}
+
+`
+
+// usesBenchLoop reports whether the code of a benchmark handles the loop itself, with
+// b.Loop() or b.N.
+func usesBenchLoop(code string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package main\nfunc _(b *testing.B) {\n"+code+"\n}\n", parser.SkipObjectResolution)
+	if err != nil {
+		return false // The compiler will report the error
+	}
+	var uses bool
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Loop" || sel.Sel.Name == "N") {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == "b" {
+				uses = true
+			}
+		}
+		return !uses
+	})
+	return uses
+}
+
+// readInput reads the content of the given files, or stdin if there are none,
+// in the same way as the -n loop would do.
+func readInput(files []string, stdin io.Reader) ([]byte, error) {
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	if len(files) == 0 {
+		return io.ReadAll(stdin)
+	}
+	var input []byte
+	for _, name := range files {
+		var b []byte
+		var err error
+		if name == "-" {
+			b, err = io.ReadAll(stdin)
+		} else {
+			b, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		input = append(input, b...)
+		// Each file is a sequence of lines
+		if len(input) > 0 && input[len(input)-1] != '\n' {
+			input = append(input, '\n')
+		}
+	}
+	return input, nil
+}
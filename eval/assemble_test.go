@@ -0,0 +1,41 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import "testing"
+
+func TestUsesBenchLoop(t *testing.T) {
+	for _, tc := range []struct {
+		code     string
+		expected bool
+	}{
+		{`strconv.Itoa(42)`, false},
+		{`for b.Loop() { strconv.Itoa(42) }`, true},
+		{`for range b.N { strconv.Itoa(42) }`, true},
+		{`for i := 0; i < b.N; i++ {}`, true},
+		{`b.ResetTimer(); for b.Loop() {}`, true},
+		{`rb.Next()`, false},
+		{`_ = sb.Name`, false},
+		{`_ = "b.N and b.Loop()"`, false},
+		{`// b.Loop()` + "\n" + `strconv.Itoa(42)`, false},
+		{`x.b.N++`, false},
+	} {
+		if got := usesBenchLoop(tc.code); got != tc.expected {
+			t.Errorf("%q: got %t", tc.code, got)
+		}
+	}
+}
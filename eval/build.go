@@ -0,0 +1,297 @@
+/*
+   Copyright 2019-2025 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dolmen-go/goeval/internal/procgroup"
+)
+
+// Reference code for running the "go" command:
+// https://github.com/golang/dl/blob/master/internal/version/version.go#L58
+
+// run runs the command, showing it if ShowCmds is set.
+func (p *Program) run(cmd *exec.Cmd) error {
+	if p.opts.ShowCmds {
+		// Inject -x in go commands
+		if cmd.Args[0] == p.opts.GoCmd && cmd.Args[1] != "env" {
+			cmd.Args = append([]string{p.opts.GoCmd, cmd.Args[1], "-x"}, cmd.Args[2:]...)
+		}
+		fmt.Fprintf(p.stdout, "%s\n", cmd.Args)
+	}
+	return cmd.Run()
+}
+
+// warn reports a non fatal error on the standard error of the program, so that it is
+// captured in [Result.Stderr] if Options.Stderr is nil.
+func (p *Program) warn(format string, args ...any) {
+	fmt.Fprintf(p.stderr, "goeval: "+format+"\n", args...)
+}
+
+// failed returns the error of a step of the build, with the output of the go command if it
+// has been captured.
+func (p *Program) failed(step string, err error) error {
+	if p.stderrBuf != nil && p.stderrBuf.Len() > 0 {
+		return fmt.Errorf("%s: %w\n%s", step, err, bytes.TrimRight(p.stderrBuf.Bytes(), "\n"))
+	}
+	return fmt.Errorf("%s: %w", step, err)
+}
+
+// testBuild reports if the code is built with "go test -c".
+func (p *Program) testBuild() bool {
+	return p.opts.Test || p.opts.Bench
+}
+
+// buildFlags returns the arguments of "go build" before the output and the source.
+func (p *Program) buildFlags() []string {
+	buildCmd := "build"
+	var buildFlags []string
+	if p.testBuild() {
+		buildCmd = "test"
+		buildFlags = append(buildFlags, "-c")
+	}
+	buildFlags = append(buildFlags,
+		// Do not embed VCS info:
+		// - there is nothing if fully built from temp dir (module mode)
+		// - or, if present, is not relevant for quick exec (GOPATH mode)
+		"-buildvcs=false",
+		// Trim paths because the paths of our ephemeral source files will not be helpful in a stack trace.
+		// This also hides goeval implementation details.
+		"-trimpath",
+	)
+	if p.overlay != "" {
+		buildFlags = append(buildFlags, "-overlay="+p.overlay)
+	}
+	buildFlags = append(buildFlags, p.opts.BuildFlags...)
+	return append([]string{buildCmd}, buildFlags...)
+}
+
+// Build builds the executable of the program at path output.
+func (p *Program) Build(ctx context.Context, output string) error {
+	ctx, cancel := p.phase(ctx, "build")
+	defer cancel()
+	if p.opts.Vet {
+		if err := p.vet(ctx); err != nil {
+			return phaseErr(ctx, err)
+		}
+	}
+	return phaseErr(ctx, p.goBuild(ctx, output))
+}
+
+// goBuild runs "go build".
+func (p *Program) goBuild(ctx context.Context, output string) error {
+	cmdBuild := procgroup.Command(ctx, p.opts.GoCmd, slices.Concat(p.buildFlags(), []string{"-o", output, p.srcFilename})...)
+	cmdBuild.Env = p.env
+	cmdBuild.Dir = p.buildDir
+	cmdBuild.Stdout = p.stdout
+	cmdBuild.Stderr = p.stderr
+	if err := p.run(cmdBuild); err != nil {
+		return p.failed("failed to build", err)
+	}
+	return nil
+}
+
+// Run builds the program (unless the executable is in the cache) and runs it.
+// A non-zero exit code of the program is not an error: see [Result.ExitCode].
+// If the run exceeds [Options.Timeout], the result is returned with a [*TimeoutError].
+func (p *Program) Run(ctx context.Context) (*Result, error) {
+	buildCtx, cancel := p.phase(ctx, "build")
+	defer cancel()
+
+	if p.opts.Vet {
+		if err := p.vet(buildCtx); err != nil {
+			return nil, phaseErr(buildCtx, err)
+		}
+	}
+
+	var exePath string
+	var cached bool // exePath is in the cache
+	if !p.noCache {
+		var err error
+		if exePath, err = p.cachedExePath(buildCtx, p.srcFilename, p.env, p.buildDir, p.buildFlags()); err != nil {
+			if buildCtx.Err() != nil {
+				return nil, phaseErr(buildCtx, err)
+			}
+			p.warn("cache: %v", err)
+		}
+		if cached = exePath != ""; cached && touchCache(exePath) == nil {
+			p.unlockWorkspace()
+			return p.runExe(ctx, exePath, true)
+		}
+	}
+
+	// Where to build
+	tmpDir := "" // os.TempDir()
+	if cached {
+		// Build in the same filesystem as the cache to allow atomic rename
+		tmpDir = filepath.Dir(exePath)
+		if err := os.MkdirAll(tmpDir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	exeDir, err := os.MkdirTemp(tmpDir, "goeval*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(exeDir); err != nil {
+			p.warn("RemoveAll(%q): %v", exeDir, err)
+		}
+	}()
+
+	buildPath := filepath.Join(exeDir, "goeval-run")
+	if goos := lookupEnv(p.env, "GOOS"); goos == "windows" || goos == "" && runtime.GOOS == "windows" {
+		buildPath += ".exe"
+	}
+
+	if err := p.goBuild(buildCtx, buildPath); err != nil {
+		return nil, phaseErr(buildCtx, err)
+	}
+	cancel()
+	// The workspace is not needed to run the program
+	p.unlockWorkspace()
+
+	if !cached {
+		return p.runExe(ctx, buildPath, false)
+	}
+	if err := os.Rename(buildPath, exePath); err != nil {
+		return nil, err
+	}
+	if err := trimCache(filepath.Dir(exePath), maxCacheSize); err != nil {
+		p.warn("cache: %v", err)
+	}
+	return p.runExe(ctx, exePath, false)
+}
+
+// runExe runs the executable of the program.
+func (p *Program) runExe(ctx context.Context, exePath string, cached bool) (*Result, error) {
+	ctx, cancel := p.phase(ctx, "run")
+	defer cancel()
+
+	runCmd, env, err := p.runner(ctx, p.env)
+	if err != nil {
+		return nil, phaseErr(ctx, err)
+	}
+	args := p.opts.Args
+	if p.opts.Bench {
+		args = append([]string{"-test.run=^$", "-test.bench=."}, args...)
+	}
+	cmdRun := exec.CommandContext(ctx, exePath, args...)
+	if runCmd != nil {
+		cmdRun = exec.CommandContext(ctx, runCmd[0], slices.Concat(runCmd[1:], []string{exePath}, args)...)
+	}
+	cmdRun.Env = env
+	cmdRun.Dir = p.runDir // In Go module mode we run from the temp module dir
+	cmdRun.Stdin = p.opts.Stdin
+	cmdRun.Stdout = p.stdout
+	cmdRun.Stderr = p.stderr
+	procgroup.Set(ctx, cmdRun)
+
+	start := time.Now()
+	err = p.run(cmdRun)
+	res := &Result{
+		ProcessState: cmdRun.ProcessState,
+		Duration:     time.Since(start),
+		Cached:       cached,
+	}
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		return nil, phaseErr(ctx, err)
+	}
+	res.ExitCode = cmdRun.ProcessState.ExitCode()
+	if p.stdoutBuf != nil {
+		res.Stdout = p.stdoutBuf.Bytes()
+	}
+	if p.stderrBuf != nil {
+		res.Stderr = p.stderrBuf.Bytes()
+	}
+	if ctx.Err() != nil {
+		return res, context.Cause(ctx)
+	}
+	return res, nil
+}
+
+// vet runs "go vet" on the source.
+func (p *Program) vet(ctx context.Context) error {
+	var out bytes.Buffer
+	vetArgs := []string{"vet"}
+	if p.overlay != "" {
+		vetArgs = append(vetArgs, "-overlay="+p.overlay)
+	}
+	vetArgs = append(vetArgs, vetFlags(p.opts.BuildFlags)...)
+	cmdVet := procgroup.Command(ctx, p.opts.GoCmd, append(vetArgs, p.srcFilename)...)
+	cmdVet.Env = p.env
+	cmdVet.Dir = p.buildDir
+	cmdVet.Stdout = p.stdout
+	cmdVet.Stderr = &out
+	err := p.run(cmdVet)
+
+	// Diagnostics in the code have been mapped to the snippet by the //line directive.
+	// As the file name is empty, add the colon that the compiler shows.
+	for line := range strings.Lines(out.String()) {
+		if line[0] >= '0' && line[0] <= '9' {
+			p.stderr.Write([]byte{':'})
+		}
+		p.stderr.Write([]byte(line))
+	}
+
+	if err != nil {
+		return p.failed("vet failed", err)
+	}
+	return nil
+}
+
+// vetFlags returns the flags of buildFlags that are supported by "go vet".
+func vetFlags(buildFlags []string) []string {
+	var flags []string
+	for _, f := range buildFlags {
+		if strings.HasPrefix(f, "-tags=") {
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
+
+// getGOMODCACHE returns the directory of the module cache.
+func (p *Program) getGOMODCACHE(ctx context.Context) (string, error) {
+	var out bytes.Buffer
+	cmd := procgroup.Command(ctx, p.opts.GoCmd, "env", "GOMODCACHE")
+	cmd.Stderr = p.stderr
+	cmd.Stdout = &out
+	cmd.Env = p.env
+	err := p.run(cmd)
+	if err != nil {
+		return "", err
+	}
+	b := bytes.TrimRight(out.Bytes(), "\r\n")
+	if len(b) == 0 {
+		return "", errors.New("can't retrieve GOMODCACHE")
+	}
+	return string(b), nil
+}
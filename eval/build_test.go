@@ -0,0 +1,73 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found")
+	}
+	ctx := context.Background()
+	// The child process of the program must be killed too
+	p, err := Assemble(ctx, &Options{Code: `fmt.Println("start"); exec.Command("sleep", "60").Run()`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// Build without timeout
+	exe := filepath.Join(t.TempDir(), "goeval-run")
+	if err := p.Build(ctx, exe); err != nil {
+		t.Fatal(err)
+	}
+
+	p.opts.Timeout = time.Second
+	start := time.Now()
+	res, err := p.runExe(ctx, exe, false)
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("run: %v", d)
+	}
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Phase != "run" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, expected run timeout", err)
+	}
+	if res == nil || string(res.Stdout) != "start\n" {
+		t.Errorf("result: %+v", res)
+	}
+}
+
+func TestRunBuildTimeout(t *testing.T) {
+	res, err := Run(context.Background(), &Options{
+		Code:    `fmt.Println("not run")`,
+		Timeout: time.Millisecond,
+	})
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Phase != "build" || timeout.Timeout != time.Millisecond {
+		t.Fatalf("got %v, expected build timeout", err)
+	}
+	if res != nil {
+		t.Errorf("result: %+v", res)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/dolmen-go/goeval/internal/procgroup"
+)
+
+// The executables built by goeval are cached in the user cache directory, keyed by a hash
+// of everything that affects the build: sources, go.mod, go.sum, Go version, GOOS/GOARCH,
+// build flags and relevant environment.
+// The size of the cache is limited: the least recently used executables are evicted.
+
+// maxCacheSize is the limit of the total size of the cached executables.
+const maxCacheSize = 512 << 20
+
+// cacheEnv is the list of Go environment variables that affect the build.
+var cacheEnv = []string{
+	"GOVERSION", "GOROOT", "GOPATH", "GO111MODULE", "GOFLAGS", "GOEXPERIMENT", "GOFIPS140", "GOTOOLCHAIN",
+	"GOOS", "GOARCH", "GO386", "GOAMD64", "GOARM", "GOARM64", "GOMIPS", "GOMIPS64", "GOPPC64", "GORISCV64", "GOWASM",
+	"CGO_ENABLED", "CC", "CXX", "CGO_CFLAGS", "CGO_CPPFLAGS", "CGO_CXXFLAGS", "CGO_LDFLAGS", "PKG_CONFIG",
+}
+
+// cacheDir returns the directory of the executables cache.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "goeval", "exe"), nil
+}
+
+// CleanCache removes all the executables from the cache.
+func CleanCache() error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// cachedExePath returns the path of the executable in the cache for the build of srcFilename
+// (a Go file, or a package directory relative to buildDir) with the given build flags.
+// An empty string is returned if the build is not cacheable.
+func (p *Program) cachedExePath(ctx context.Context, srcFilename string, env []string, buildDir string, buildFlags []string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "build %q\n", buildFlags)
+	for _, f := range buildFlags {
+		// The content of the profile affects the build
+		if pgo, ok := strings.CutPrefix(f, "-pgo="); ok && pgo != "auto" && pgo != "off" {
+			b, err := os.ReadFile(pgo)
+			if err != nil {
+				return "", nil // Let "go build" report the error
+			}
+			fmt.Fprintf(h, "file %q %d\n", f, len(b))
+			h.Write(b)
+		}
+	}
+
+	var goenv bytes.Buffer
+	cmd := procgroup.Command(ctx, p.opts.GoCmd, append([]string{"env"}, cacheEnv...)...)
+	cmd.Env = env
+	cmd.Dir = buildDir
+	cmd.Stdout = &goenv
+	cmd.Stderr = p.stderr
+	if err := p.run(cmd); err != nil {
+		return "", err
+	}
+	h.Write(goenv.Bytes())
+	goenvValues := strings.Split(goenv.String(), "\n")
+	getenv := func(name string) string {
+		return goenvValues[slices.Index(cacheEnv, name)]
+	}
+	goroot, gomodule := getenv("GOROOT"), getenv("GO111MODULE")
+
+	// Collect the source files. The name of our temporary source file is not relevant.
+	files := map[string]string{} // name => path
+	srcPath := srcFilename
+	if !filepath.IsAbs(srcPath) {
+		srcPath = filepath.Join(buildDir, srcPath)
+	}
+	if strings.HasSuffix(srcPath, ".go") {
+		files["main.go"] = srcPath
+		for _, name := range []string{"go.mod", "go.sum", "go.work"} {
+			if _, err := os.Stat(filepath.Join(buildDir, name)); err == nil {
+				files[name] = filepath.Join(buildDir, name)
+			}
+		}
+	} else {
+		err := filepath.WalkDir(srcPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			name, _ := filepath.Rel(srcPath, path)
+			files[filepath.ToSlash(name)] = path
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		b, err := os.ReadFile(files[name])
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case name == "go.work":
+			// Modules in local directories may change
+			return "", nil
+		case name == "go.mod":
+			// Dependencies in local directories may change
+			if hasLocalReplace(b) {
+				return "", nil
+			}
+		case strings.HasSuffix(name, ".go") && gomodule == "off":
+			// In GOPATH mode, packages outside of GOROOT may change
+			if !stdImportsOnly(goroot, b) {
+				return "", nil
+			}
+		}
+		fmt.Fprintf(h, "file %q %d\n", name, len(b))
+		h.Write(b)
+	}
+
+	name := hex.EncodeToString(h.Sum(nil))
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// hasLocalReplace reports whether go.mod replaces a module by a local directory, or can't be
+// parsed. modfile.ParseLax would ignore replace directives.
+func hasLocalReplace(gomod []byte) bool {
+	f, err := modfile.Parse("go.mod", gomod, nil)
+	return err != nil || slices.ContainsFunc(f.Replace, func(r *modfile.Replace) bool {
+		return modfile.IsDirectoryPath(r.New.Path)
+	})
+}
+
+// stdImportsOnly reports whether the Go source imports only packages of GOROOT.
+func stdImportsOnly(goroot string, src []byte) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return false
+	}
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || path == "C" {
+			return false
+		}
+		if _, err := os.Stat(filepath.Join(goroot, "src", filepath.FromSlash(path))); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// touchCache marks the cached executable as used. An error is returned if it doesn't exist.
+func touchCache(exePath string) error {
+	now := time.Now()
+	return os.Chtimes(exePath, now, now)
+}
+
+// trimCache evicts the least recently used executables to keep the cache under maxSize.
+func trimCache(dir string, maxSize int64) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var infos []fs.FileInfo
+	var total int64
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			infos = append(infos, info)
+			total += info.Size()
+		}
+	}
+	// Oldest first
+	slices.SortFunc(infos, func(a, b fs.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+	var errs []error
+	for _, info := range infos {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		total -= info.Size()
+	}
+	return errors.Join(errs...)
+}
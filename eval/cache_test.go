@@ -0,0 +1,168 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrimCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	// a is the least recently used, c the most recently used
+	for i, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, 100), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i-3) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b is used again
+	if err := touchCache(filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := trimCache(dir, 250); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, []string{"b", "c"}) {
+		t.Errorf("got %q, expected [b c]", names)
+	}
+}
+
+func TestStdImportsOnly(t *testing.T) {
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goroot := strings.TrimSpace(string(out))
+	for _, tc := range []struct {
+		src      string
+		expected bool
+	}{
+		{`package main`, true},
+		{`package main; import ("fmt"; _ "embed"; s "net/http")`, true},
+		{`package main; import "C"`, false},
+		{`package main; import "golang.org/x/mod/module"`, false},
+		{`package main; import "mypkg"`, false},
+	} {
+		if got := stdImportsOnly(goroot, []byte(tc.src)); got != tc.expected {
+			t.Errorf("%s: got %t", tc.src, got)
+		}
+	}
+}
+
+func TestHasLocalReplace(t *testing.T) {
+	for _, tc := range []struct {
+		gomod    string
+		expected bool
+	}{
+		{"module goeval\n", false},
+		{"module goeval\nrequire example.com/a v1.0.0\n", false},
+		{"module goeval\nreplace example.com/a => example.com/b v1.1.0\n", false},
+		// Regression: replace directives are ignored by modfile.ParseLax
+		{"module goeval\nreplace example.com/a => ./a\n", true},
+		{"module goeval\nreplace example.com/a v1.0.0 => /tmp/a\n", true},
+		{"module goeval\nreplace (\n", true},
+	} {
+		if got := hasLocalReplace([]byte(tc.gomod)); got != tc.expected {
+			t.Errorf("%q: got %t", tc.gomod, got)
+		}
+	}
+}
+
+func TestCachedExePathPGO(t *testing.T) {
+	p, err := newProgram(&Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(src, []byte("package main\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	profile := filepath.Join(dir, "default.pgo")
+
+	exePath := func() string {
+		t.Helper()
+		path, err := p.cachedExePath(context.Background(), src, p.env, dir, []string{"build", "-pgo=" + profile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Missing profile: not cacheable
+	if path := exePath(); path != "" {
+		t.Errorf("missing profile: got %q", path)
+	}
+	if err := os.WriteFile(profile, []byte("profile 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path1 := exePath()
+	if err := os.WriteFile(profile, []byte("profile 2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if path2 := exePath(); path1 == "" || path2 == path1 {
+		t.Errorf("the cache key doesn't depend on the content of the profile: %q %q", path1, path2)
+	}
+}
+
+func TestCachedExePathGOFIPS140(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(src, []byte("package main\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	exePath := func(fips string) string {
+		t.Helper()
+		p, err := newProgram(&Options{Env: append(os.Environ(), "GOFIPS140="+fips)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := p.cachedExePath(context.Background(), src, p.env, dir, []string{"build"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// GOFIPS140 selects the version of the crypto module linked in the executable
+	if off, latest := exePath("off"), exePath("latest"); off == "" || off == latest {
+		t.Errorf("the cache key doesn't depend on GOFIPS140: %q %q", off, latest)
+	}
+}
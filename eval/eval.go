@@ -0,0 +1,311 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package eval assembles, builds and runs Go snippets. This is the engine of the goeval command.
+//
+// The snippet ([Options.Code]) is wrapped as the body of a main function, with imports and
+// top-level declarations, and imports are fixed with [goimports]. If an import has a version,
+// a Go module is assembled and its dependencies are resolved with "go get".
+//
+//	res, err := eval.Run(ctx, &eval.Options{
+//		Code: `fmt.Println("Hello, world!")`,
+//	})
+//
+// A Go toolchain must be available in $PATH (or given with [Options.GoCmd]).
+//
+// [goimports]: https://pkg.go.dev/golang.org/x/tools/imports
+package eval
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"golang.org/x/tools/txtar"
+)
+
+// Options are the options of [Assemble], [Build] and [Run].
+// Most of them match a flag of the goeval command.
+type Options struct {
+	// Code is the snippet: the body of the main function (goeval <code>).
+	Code string
+	// CodePos is the position (file:line) of Code reported in compiler messages.
+	// Default: ":1".
+	CodePos string
+	// Args are the arguments of the program.
+	Args []string
+
+	// Imports are the imported packages (goeval -i):
+	//   - [alias=]import-path
+	//   - [alias=]import-path@version: Go module mode
+	//   - [alias=]module-path[@version]=>./dir: module in a local directory
+	//   - module-path[@version]=>module-path@version: replacement of a dependency
+	//
+	// Each item may be a comma-separated list.
+	Imports []string
+	// Decls are top-level declarations (goeval -d).
+	Decls []string
+
+	// Print evaluates Code as an expression and prints its value(s) (goeval -p).
+	Print bool
+	// Lines runs Code for each line of the files given as Args, or Stdin (goeval -n).
+	Lines bool
+	// PrintLines also prints the line after each iteration of Lines (goeval -l).
+	PrintLines bool
+	// Test runs Code as the body of a test function with "go test" (goeval -test).
+	Test bool
+	// Bench runs Code as the body of a benchmark function with "go test" (goeval -bench).
+	Bench bool
+
+	// Playground assembles the program for the Go Playground (goeval -Eplay, -play, -share):
+	// Args, the input of Lines and GOEXPERIMENT are embedded in the source.
+	Playground bool
+
+	// Goimports is the goimports command that fixes imports and formats the source (goeval -goimports).
+	// The default ("") is the goimports library. "off" disables it.
+	Goimports string
+	// Format, if set, is used instead of goimports. codeLine is the line of Code in src.
+	Format func(ctx context.Context, src []byte, codeLine int) ([]byte, error)
+
+	// GoCmd is the go command. Default: "go".
+	GoCmd string
+	// Env is the environment of the go command and of the program. Default: os.Environ().
+	// The goimports library uses the environment of the process: with ModHere or Use, GOFLAGS
+	// and GOWORK are set in the environment of the process while goimports runs, which
+	// affects the other goroutines (only the goimports steps of concurrent [Assemble] calls are serialized).
+	// Set Goimports or Format to avoid it.
+	Env []string
+	// Dir is the working directory of the program. Default: the current directory.
+	Dir string
+
+	// Workspace keeps the module in a persistent workspace with this name (goeval -workspace).
+	Workspace string
+	// Lock is a lock file of the module versions (goeval -lock).
+	Lock string
+	// Offline resolves modules only from the module cache (goeval -offline).
+	Offline bool
+	// Use are local directories of modules of a Go workspace (goeval -use).
+	Use []string
+	// ModHere builds the code in the Go module of Dir (goeval -mod=here).
+	ModHere bool
+	// Verbose prints the selected version of each module on Stderr (goeval -v).
+	Verbose bool
+
+	// BuildFlags are flags for "go build", such as "-tags=..." or "-race".
+	// File paths, such as the profile of -pgo, must be absolute: "go build" doesn't run in Dir.
+	BuildFlags []string
+	// GOOS and GOARCH are the target platform (goeval -goos, -goarch).
+	GOOS, GOARCH string
+	// Exec is the runner command of the executable (goeval -exec).
+	Exec string
+	// Vet checks the code with "go vet" before building it (goeval -vet).
+	Vet bool
+	// NoCache disables the cache of executables (goeval -cache=off).
+	NoCache bool
+	// Timeout, if not zero, limits the duration of each phase: the resolution of modules
+	// ([Assemble]), the build and the run (goeval -timeout). On expiry, the commands of the
+	// phase are killed with their child processes and a [*TimeoutError] is returned.
+	Timeout time.Duration
+
+	// ShowCmds prints the commands executed on Stdout (goeval -x).
+	ShowCmds bool
+
+	// Stdin is the input of the program.
+	Stdin io.Reader
+	// Stdout and Stderr are the outputs of the program and of the go command.
+	// If nil, the output is captured in the [Result].
+	Stdout, Stderr io.Writer
+}
+
+// A Program is a snippet assembled by [Assemble], ready to be built and run.
+// [Program.Close] removes its temporary files.
+type Program struct {
+	opts Options
+
+	env            []string
+	stdout, stderr io.Writer
+	stdoutBuf      *bytes.Buffer // captured Stdout
+	stderrBuf      *bytes.Buffer // captured Stderr
+
+	dir         string // directory of the module (or of the temporary files)
+	srcFilename string // Go file or package directory to build
+	buildDir    string // directory of "go build"
+	runDir      string // directory of the program
+	overlay     string // overlay file of "go build" (ModHere)
+	noCache     bool
+	source      []byte
+	archive     *txtar.Archive // set if the program comes from an archive
+	unlock      func()         // releases the lock of the workspace
+
+	cleanups []func()
+}
+
+// A Result is the result of a run of a program.
+type Result struct {
+	// ExitCode is the exit code of the program, or -1 if it was terminated by a signal.
+	ExitCode int
+	// ProcessState is the state of the exited program.
+	ProcessState *os.ProcessState
+	// Duration is the run time of the program, excluding the build.
+	Duration time.Duration
+	// Cached reports if the executable was found in the cache.
+	Cached bool
+	// Stdout and Stderr are the captured outputs, if Options.Stdout and Options.Stderr are nil.
+	Stdout, Stderr []byte
+}
+
+// A TimeoutError is returned when a phase exceeds [Options.Timeout].
+type TimeoutError struct {
+	Phase   string // "resolve", "build" or "run"
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: timeout after %v", e.Phase, e.Timeout)
+}
+
+// Unwrap returns [context.DeadlineExceeded].
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// phase returns the context of a phase, limited by Options.Timeout.
+func (p *Program) phase(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	if p.opts.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, p.opts.Timeout, &TimeoutError{Phase: name, Timeout: p.opts.Timeout})
+}
+
+// phaseErr returns the cause (such as a [*TimeoutError]) of err if ctx is done.
+func phaseErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// newProgram returns a program with opts completed with defaults.
+func newProgram(opts *Options) (*Program, error) {
+	p := &Program{opts: *opts}
+	if p.opts.GoCmd == "" {
+		p.opts.GoCmd = "go"
+	}
+	goCmd, err := exec.LookPath(p.opts.GoCmd)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", p.opts.GoCmd, err)
+	}
+	p.opts.GoCmd = goCmd
+	if p.opts.CodePos == "" {
+		p.opts.CodePos = ":1"
+	}
+	if p.opts.Env == nil {
+		p.opts.Env = os.Environ()
+	}
+	p.env = slices.Clip(p.opts.Env)
+	if p.opts.Dir == "" {
+		if p.opts.Dir, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	} else if p.opts.Dir, err = filepath.Abs(p.opts.Dir); err != nil {
+		return nil, err
+	}
+	p.runDir = p.opts.Dir
+	p.noCache = p.opts.NoCache
+
+	p.stdout, p.stderr = p.opts.Stdout, p.opts.Stderr
+	if p.stdout == nil {
+		p.stdoutBuf = new(bytes.Buffer)
+		p.stdout = p.stdoutBuf
+	}
+	if p.stderr == nil {
+		p.stderrBuf = new(bytes.Buffer)
+		p.stderr = p.stderrBuf
+	}
+	return p, nil
+}
+
+// Source returns the assembled Go source.
+func (p *Program) Source() []byte {
+	return p.source
+}
+
+// Archive returns the program as a txtar archive: the Go source is the comment of the
+// archive, followed by go.mod, go.sum and go.work in Go module mode.
+// This is the format of goeval -E and of the Go Playground.
+func (p *Program) Archive() (*txtar.Archive, error) {
+	if p.archive != nil {
+		return p.archive, nil
+	}
+	ar := &txtar.Archive{Comment: p.source}
+	if p.dir == "" {
+		return ar, nil
+	}
+	for _, name := range []string{"go.mod", "go.sum", "go.work"} {
+		b, err := os.ReadFile(filepath.Join(p.dir, name))
+		if os.IsNotExist(err) && name != "go.mod" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ar.Files = append(ar.Files, txtar.File{Name: name, Data: b})
+	}
+	return ar, nil
+}
+
+// Close removes the temporary files of the program.
+func (p *Program) Close() error {
+	for _, cleanup := range slices.Backward(p.cleanups) {
+		cleanup()
+	}
+	p.cleanups = nil
+	return nil
+}
+
+// Build assembles the snippet and builds the executable at path output.
+func Build(ctx context.Context, opts *Options, output string) error {
+	p, err := Assemble(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	return p.Build(ctx, output)
+}
+
+// Run assembles the snippet, builds it and runs it.
+// A non-zero exit code of the program is not an error: see [Result.ExitCode].
+// If the run exceeds [Options.Timeout], the result is returned with a [*TimeoutError].
+func Run(ctx context.Context, opts *Options) (*Result, error) {
+	p, err := Assemble(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	return p.Run(ctx)
+}
+
+// CheckImport checks the syntax of an import of [Options.Imports].
+func CheckImport(s string) error {
+	imp := imports{packages: map[string]string{}}
+	return imp.Set(s)
+}
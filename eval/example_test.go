@@ -0,0 +1,91 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dolmen-go/goeval/eval"
+)
+
+func ExampleRun() {
+	res, err := eval.Run(context.Background(), &eval.Options{
+		Code: `fmt.Println("Hello,", os.Args[1]); os.Exit(3)`,
+		Args: []string{"world"},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("exit %d: %q\n", res.ExitCode, res.Stdout)
+
+	// Output:
+	// exit 3: "Hello, world\n"
+}
+
+func ExampleRun_print() {
+	for _, code := range []string{
+		`1 + 2, "a" + "b"`,
+		`1 + 2 // comment`,
+		// A nil error is not printed
+		`strconv.Atoi("4")`,
+		`func() (int, *os.PathError) { return 5, nil }()`,
+	} {
+		_, err := eval.Run(context.Background(), &eval.Options{
+			Code:   code,
+			Print:  true,
+			Stdout: os.Stdout,
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	// Output:
+	// 3 ab
+	// 3
+	// 4
+	// 5
+}
+
+func ExampleRun_buildError() {
+	_, err := eval.Run(context.Background(), &eval.Options{
+		Code: `undefined()`,
+	})
+	fmt.Println(err)
+
+	// Output:
+	// failed to build: exit status 1
+	// # command-line-arguments
+	// :1: undefined: undefined
+}
+
+func ExampleAssemble() {
+	p, err := eval.Assemble(context.Background(), &eval.Options{
+		Code:  `strings.ToUpper(s)`,
+		Decls: []string{`const s = "hello"`},
+		Print: true,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer p.Close()
+	os.Stdout.Write(p.Source())
+}
@@ -0,0 +1,282 @@
+/*
+   Copyright 2019-2025 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// imports is the storage for [Options.Imports].
+// imports implements interface flag.Value.
+type imports struct {
+	packages   map[string]string // alias => import path
+	modules    map[string]string // module path => version
+	replaces   map[string]string // module path[@version] => local directory or module path@version
+	onlySemVer bool
+}
+
+func (*imports) String() string {
+	return "" // irrelevant
+}
+
+func (imp *imports) Set(s string) error {
+	// Allow "fmt,os"
+	// Comma is not allowed in import path
+	if p1, remainder, ok := strings.Cut(s, ","); ok {
+		if err := imp.Set(p1); err != nil {
+			return err
+		}
+		return imp.Set(remainder)
+	}
+
+	if lhs, repl, ok := strings.Cut(s, "=>"); ok {
+		return imp.setReplace(s, lhs, repl)
+	}
+
+	// Optional aliasing with [alias=]import
+	var alias, path, version string
+	var ok bool
+	if alias, path, ok = strings.Cut(s, "="); !ok {
+		alias = ""
+		path = s
+	} else if alias == "" {
+		return fmt.Errorf("%q: empty alias", s)
+	} else if alias == "_" || alias == "." {
+		tmpPath, _, _ := strings.Cut(path, "@")
+		alias = alias + " " + tmpPath // special alias
+	} else if strings.Contains(alias, " ") {
+		return fmt.Errorf("%q: invalid alias", s)
+	}
+	var p2 string
+	if p2, version, ok = strings.Cut(path, "@"); ok {
+		switch version {
+		case "":
+			return fmt.Errorf("%q: empty module version", s)
+		case "none":
+			return fmt.Errorf("%q: invalid version query", s)
+		}
+		path = p2
+		if err := module.CheckPath(path); err != nil {
+			return fmt.Errorf("%q: %w", s, err)
+		}
+		// TODO check for duplicates
+		if imp.modules == nil {
+			imp.modules = make(map[string]string)
+		}
+		imp.modules[path] = version
+		imp.onlySemVer = imp.onlySemVer && !isVersionQuery(version)
+	} else if alias == "" {
+		alias = "  " + path // special alias
+	}
+
+	switch path {
+	case "":
+		return fmt.Errorf("%q: empty path", s)
+	case "embed":
+		return errors.New("use of package 'embed' is not allowed")
+
+	default:
+		if err := module.CheckImportPath(path); err != nil {
+			return fmt.Errorf("%q: %w", s, err)
+		}
+	}
+
+	if alias != "" {
+		imp.packages[alias] = path
+	}
+
+	// log.Printf("alias=%s path=%s version=%s", alias, path, version)
+
+	return nil
+}
+
+// zeroPseudoVersion is the version required for a module replaced by a local directory,
+// if no version is given.
+const zeroPseudoVersion = "v0.0.0-00010101000000-000000000000"
+
+// setReplace handles the replacement of a module:
+//   - [alias=]path[@version]=>dir imports the package path from the module in the local directory dir
+//   - path[@version]=>newpath@version replaces a dependency with another module
+func (imp *imports) setReplace(s, lhs, repl string) error {
+	if repl == "" {
+		return fmt.Errorf("%q: empty replacement", s)
+	}
+	if modfile.IsDirectoryPath(repl) {
+		dir, err := filepath.Abs(repl)
+		if err != nil {
+			return fmt.Errorf("%q: %w", s, err)
+		}
+		if !strings.Contains(lhs, "@") {
+			lhs += "@" + zeroPseudoVersion
+		}
+		// Import the module as if it was published
+		if err := imp.Set(lhs); err != nil {
+			return err
+		}
+		alias, pathVersion, hasAlias := strings.Cut(lhs, "=")
+		if !hasAlias {
+			pathVersion = lhs
+		}
+		path, _, _ := strings.Cut(pathVersion, "@")
+		if !hasAlias {
+			// Unlike path@version, import the package
+			alias = "  " + path // special alias
+			imp.packages[alias] = path
+		}
+		if imp.replaces == nil {
+			imp.replaces = make(map[string]string)
+		}
+		imp.replaces[path] = dir
+		return nil
+	}
+
+	if strings.Contains(lhs, "=") {
+		return fmt.Errorf("%q: alias not allowed for the replacement of a module", s)
+	}
+	path, version, _ := strings.Cut(lhs, "@")
+	if err := module.CheckPath(path); err != nil {
+		return fmt.Errorf("%q: %w", s, err)
+	}
+	if version != "" && version != module.CanonicalVersion(version) {
+		return fmt.Errorf("%q: invalid version %q", s, version)
+	}
+	newPath, newVersion, ok := strings.Cut(repl, "@")
+	if !ok || newVersion == "" {
+		return fmt.Errorf("%q: the replacement module requires a version", s)
+	}
+	if err := module.CheckPath(newPath); err != nil {
+		return fmt.Errorf("%q: %w", s, err)
+	}
+	if imp.replaces == nil {
+		imp.replaces = make(map[string]string)
+	}
+	imp.replaces[lhs] = repl
+	return nil
+}
+
+// replacedByDir returns true if the package path belongs to a module replaced by a local directory.
+func (imp *imports) replacedByDir(path string) bool {
+	for mod, repl := range imp.replaces {
+		if (path == mod || strings.HasPrefix(path, mod+"/")) && modfile.IsDirectoryPath(repl) {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleVersion returns the version given in the imports of the module providing the package path,
+// or an empty string if the module is unknown.
+func (imp *imports) moduleVersion(path string) string {
+	var modPath, version string
+	for mod, ver := range imp.modules {
+		if (path == mod || strings.HasPrefix(path, mod+"/")) && len(mod) > len(modPath) {
+			modPath, version = mod, ver
+		}
+	}
+	return version
+}
+
+// proxyModules returns the modules (module path => version) to download from a module proxy:
+// modules replaced by a local directory are excluded and other replacements are applied.
+func (imp *imports) proxyModules() map[string]string {
+	modules := make(map[string]string, len(imp.modules))
+	for mod, ver := range imp.modules {
+		if imp.replacedByDir(mod) {
+			continue
+		}
+		if repl, ok := imp.replaces[mod+"@"+ver]; ok {
+			mod, ver, _ = strings.Cut(repl, "@")
+		} else if repl, ok := imp.replaces[mod]; ok {
+			mod, ver, _ = strings.Cut(repl, "@")
+		}
+		modules[mod] = ver
+	}
+	return modules
+}
+
+// writeGoMod writes the go.mod file of the module built in module mode, with the replace
+// directives of the imports. An existing go.mod ([Options.Workspace]) is updated.
+func writeGoMod(gomod string, moduleName string, replaces map[string]string) error {
+	data, err := os.ReadFile(gomod)
+	if errors.Is(err, os.ErrNotExist) {
+		data = []byte("module " + moduleName + "\n")
+	} else if err != nil {
+		return err
+	}
+	f, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return err
+	}
+	for _, r := range slices.Clone(f.Replace) {
+		if err := f.DropReplace(r.Old.Path, r.Old.Version); err != nil {
+			return err
+		}
+	}
+	for _, old := range slices.Sorted(maps.Keys(replaces)) {
+		oldPath, oldVersion, _ := strings.Cut(old, "@")
+		newPath, newVersion, _ := strings.Cut(replaces[old], "@")
+		if modfile.IsDirectoryPath(replaces[old]) {
+			newPath, newVersion = replaces[old], ""
+		}
+		if err := f.AddReplace(oldPath, oldVersion, newPath, newVersion); err != nil {
+			return err
+		}
+	}
+	f.Cleanup()
+	if data, err = f.Format(); err != nil {
+		return err
+	}
+	return os.WriteFile(gomod, data, 0600)
+}
+
+// setGoVersion sets the go version of gomod, if missing, to the go version of gowork.
+func setGoVersion(gomod string, gowork string) error {
+	b, err := os.ReadFile(gowork)
+	if err != nil {
+		return err
+	}
+	work, err := modfile.ParseWork(gowork, b, nil)
+	if err != nil {
+		return err
+	}
+	if b, err = os.ReadFile(gomod); err != nil {
+		return err
+	}
+	f, err := modfile.Parse(gomod, b, nil)
+	if err != nil {
+		return err
+	}
+	if f.Go != nil || work.Go == nil {
+		return nil
+	}
+	if err := f.AddGoStmt(work.Go.Version); err != nil {
+		return err
+	}
+	if b, err = f.Format(); err != nil {
+		return err
+	}
+	return os.WriteFile(gomod, b, 0600)
+}
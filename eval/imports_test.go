@@ -0,0 +1,39 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import "testing"
+
+func TestCheckImport(t *testing.T) {
+	for _, tc := range []struct {
+		imp   string
+		valid bool
+	}{
+		{"fmt", true},
+		{"fmt,os", true},
+		{"s=strings,golang.org/x/mod/semver@v0.26.0", true},
+		{"example.com/greet=>./greet", true},
+		{"@bad", false},
+		{"fmt,@bad", false},
+		{"fmt,os,=strings", false},
+		{"fmt,embed", false},
+	} {
+		if err := CheckImport(tc.imp); (err == nil) != tc.valid {
+			t.Errorf("%q: got %v", tc.imp, err)
+		}
+	}
+}
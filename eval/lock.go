@@ -0,0 +1,112 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/tools/txtar"
+)
+
+// A lock file ([Options.Lock]) is a txtar archive of the go.mod and go.sum resolved in module mode.
+// The comment of the archive is the list of module requests (as given to "go get") that
+// produced it, to detect that the imports have changed.
+
+// readLock reads the lock file. A nil archive is returned if the file doesn't exist.
+func readLock(name string, request []string) (*txtar.Archive, error) {
+	ar, err := txtar.ParseFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if string(ar.Comment) != strings.Join(request, "\n")+"\n" {
+		return nil, fmt.Errorf("%s: lock file doesn't match the imported modules (remove it to resolve them again)", name)
+	}
+	for _, f := range ar.Files {
+		if f.Name != "go.mod" && f.Name != "go.sum" {
+			return nil, fmt.Errorf("%s: unexpected file %q", name, f.Name)
+		}
+	}
+	return ar, nil
+}
+
+// writeLock writes the go.mod and go.sum of dir to the lock file.
+func writeLock(name string, dir string, request []string) error {
+	ar := &txtar.Archive{
+		Comment: []byte(strings.Join(request, "\n") + "\n"),
+	}
+	for _, f := range []string{"go.mod", "go.sum"} {
+		b, err := os.ReadFile(filepath.Join(dir, f))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ar.Files = append(ar.Files, txtar.File{Name: f, Data: b})
+	}
+	return os.WriteFile(name, txtar.Format(ar), 0o644)
+}
+
+// reportVersions prints the versions of modules selected in go.mod, with the version query
+// of the modules imported if it was not an exact version.
+func reportVersions(w io.Writer, gomod string, modules map[string]string) error {
+	b, err := os.ReadFile(gomod)
+	if err != nil {
+		return err
+	}
+	f, err := modfile.Parse(gomod, b, nil)
+	if err != nil {
+		return err
+	}
+	for _, r := range f.Require {
+		fmt.Fprintf(w, "%s %s", r.Mod.Path, r.Mod.Version)
+		if query, ok := modules[r.Mod.Path]; ok && query != r.Mod.Version {
+			fmt.Fprintf(w, " (@%s)", query)
+		}
+		for _, rep := range f.Replace {
+			if rep.Old.Path == r.Mod.Path && (rep.Old.Version == "" || rep.Old.Version == r.Mod.Version) {
+				fmt.Fprintf(w, " => %s", rep.New.Path)
+				if rep.New.Version != "" {
+					fmt.Fprintf(w, " %s", rep.New.Version)
+				}
+			}
+		}
+		if r.Indirect {
+			if _, ok := modules[r.Mod.Path]; !ok {
+				io.WriteString(w, " // indirect")
+			}
+		}
+		io.WriteString(w, "\n")
+	}
+	return nil
+}
+
+// isVersionQuery returns true if version is not an exact version, but a module query
+// (see https://go.dev/ref/mod#version-queries) that must be resolved by "go get".
+func isVersionQuery(version string) bool {
+	return version != module.CanonicalVersion(version)
+}
@@ -0,0 +1,135 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// The download directory of the module cache (GOMODCACHE/cache/download) has the layout
+// of a module proxy (see https://go.dev/ref/mod#module-cache), so it can be used
+// as GOPROXY with a file:// URL to resolve modules without network ([Options.Offline]).
+
+// downloadPath returns the path of a file of the module proxy layout in the module cache.
+// ext is ".mod", ".zip", ".info" or "" for the list of versions.
+func downloadPath(gomodcache string, path string, version string, ext string) (string, error) {
+	escPath, err := module.EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	if ext == "" {
+		return filepath.Join(gomodcache, "cache", "download", filepath.FromSlash(escPath), "@v", "list"), nil
+	}
+	escVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gomodcache, "cache", "download", filepath.FromSlash(escPath), "@v", escVersion+ext), nil
+}
+
+// inModCache returns true if the module version is fully available in the module cache:
+// go.mod (.mod), source (.zip) and metadata (.info).
+func inModCache(gomodcache string, path string, version string) bool {
+	for _, ext := range []string{".mod", ".zip", ".info"} {
+		name, err := downloadPath(gomodcache, path, version, ext)
+		if err != nil {
+			return false
+		}
+		if _, err := os.Stat(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// offlineProxy returns the GOPROXY value that serves modules from the module cache.
+func offlineProxy(gomodcache string) string {
+	p := filepath.ToSlash(filepath.Join(gomodcache, "cache", "download"))
+	if !strings.HasPrefix(p, "/") { // Windows: C:/...
+		p = "/" + p
+	}
+	return "file://" + p
+}
+
+// missingModules walks the module graph from the given modules (module path => version)
+// through the go.mod files in the module cache, and returns the modules that are missing
+// from the cache. The graph is pruned like the go command does for modules at go 1.17
+// or higher.
+func missingModules(gomodcache string, modules map[string]string) []string {
+	var missing []string
+	seen := make(map[module.Version]bool)
+
+	exists := func(path, version, ext string) bool {
+		name, err := downloadPath(gomodcache, path, version, ext)
+		if err != nil {
+			return false
+		}
+		_, err = os.Stat(name)
+		return err == nil
+	}
+
+	var walk func(m module.Version, direct bool)
+	walk = func(m module.Version, direct bool) {
+		if seen[m] {
+			return
+		}
+		seen[m] = true
+		if isVersionQuery(m.Version) {
+			if !exists(m.Path, "", "") {
+				missing = append(missing, m.Path+"@"+m.Version+" (list of versions)")
+			}
+			return
+		}
+		name, err := downloadPath(gomodcache, m.Path, m.Version, ".mod")
+		if err != nil {
+			missing = append(missing, m.String()+" ("+err.Error()+")")
+			return
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			missing = append(missing, m.String())
+			return
+		}
+		if direct && !exists(m.Path, m.Version, ".zip") {
+			missing = append(missing, m.String()+" (source)")
+		}
+		f, err := modfile.ParseLax(name, data, nil)
+		if err != nil {
+			return
+		}
+		// The requirements of an indirect module at go 1.17 or higher are pruned out
+		if !direct && f.Go != nil && semver.Compare("v"+f.Go.Version, "v1.17") >= 0 {
+			return
+		}
+		for _, r := range f.Require {
+			walk(r.Mod, false)
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(modules)) {
+		walk(module.Version{Path: path, Version: modules[path]}, true)
+	}
+	slices.Sort(missing)
+	return missing
+}
@@ -0,0 +1,138 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeModCache creates files in a synthetic module cache.
+func writeModCache(t *testing.T, gomodcache string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(gomodcache, "cache", "download", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDownloadPath(t *testing.T) {
+	gomodcache := filepath.FromSlash("/gomodcache")
+	for _, tc := range []struct {
+		path, version, ext string
+		expected           string
+	}{
+		{"golang.org/x/mod", "v0.26.0", ".mod", "golang.org/x/mod/@v/v0.26.0.mod"},
+		{"github.com/BurntSushi/toml", "v1.0.0", ".zip", "github.com/!burnt!sushi/toml/@v/v1.0.0.zip"},
+		{"github.com/Masterminds/semver/v3", "v3.2.0-RC1", ".info", "github.com/!masterminds/semver/v3/@v/v3.2.0-!r!c1.info"},
+		{"github.com/BurntSushi/toml", "", "", "github.com/!burnt!sushi/toml/@v/list"},
+	} {
+		got, err := downloadPath(gomodcache, tc.path, tc.version, tc.ext)
+		if err != nil {
+			t.Errorf("%s@%s: %v", tc.path, tc.version, err)
+			continue
+		}
+		expected := filepath.Join(gomodcache, "cache", "download", filepath.FromSlash(tc.expected))
+		if got != expected {
+			t.Errorf("%s@%s: got %q, expected %q", tc.path, tc.version, got, expected)
+		}
+	}
+
+	if _, err := downloadPath(gomodcache, "github.com/!invalid", "v1.0.0", ".mod"); err == nil {
+		t.Error("error expected for invalid module path")
+	}
+}
+
+func TestInModCache(t *testing.T) {
+	gomodcache := t.TempDir()
+	writeModCache(t, gomodcache, map[string]string{
+		"github.com/!burnt!sushi/toml/@v/v1.0.0.mod":  "module github.com/BurntSushi/toml\n",
+		"github.com/!burnt!sushi/toml/@v/v1.0.0.zip":  "",
+		"github.com/!burnt!sushi/toml/@v/v1.0.0.info": "{}",
+		// No .zip
+		"github.com/!burnt!sushi/toml/@v/v1.1.0.mod":  "module github.com/BurntSushi/toml\n",
+		"github.com/!burnt!sushi/toml/@v/v1.1.0.info": "{}",
+		// Not escaped: never written by the go command
+		"github.com/Foo/bar/@v/v1.0.0.mod":  "module github.com/Foo/bar\n",
+		"github.com/Foo/bar/@v/v1.0.0.zip":  "",
+		"github.com/Foo/bar/@v/v1.0.0.info": "{}",
+	})
+
+	for _, tc := range []struct {
+		path, version string
+		expected      bool
+	}{
+		{"github.com/BurntSushi/toml", "v1.0.0", true},
+		{"github.com/BurntSushi/toml", "v1.1.0", false},
+		{"github.com/BurntSushi/toml", "v1.2.0", false},
+		{"github.com/burntsushi/toml", "v1.0.0", false},
+		{"github.com/Foo/bar", "v1.0.0", false},
+	} {
+		if got := inModCache(gomodcache, tc.path, tc.version); got != tc.expected {
+			t.Errorf("%s@%s: got %t, expected %t", tc.path, tc.version, got, tc.expected)
+		}
+	}
+}
+
+func TestMissingModules(t *testing.T) {
+	gomodcache := t.TempDir()
+	writeModCache(t, gomodcache, map[string]string{
+		"example.com/!a/@v/v1.0.0.mod": "module example.com/A\ngo 1.21\nrequire (\n\texample.com/b v1.0.0\n\texample.com/c v1.0.0\n)\n",
+		"example.com/!a/@v/v1.0.0.zip": "",
+		// b is pruned: its requirements are not needed
+		"example.com/b/@v/v1.0.0.mod": "module example.com/b\ngo 1.21\nrequire example.com/pruned v1.0.0\n",
+		// c is not pruned (go < 1.17)
+		"example.com/c/@v/v1.0.0.mod": "module example.com/c\ngo 1.16\nrequire example.com/d v1.0.0\n",
+		// No .zip
+		"example.com/e/@v/v1.0.0.mod": "module example.com/e\n",
+	})
+
+	got := missingModules(gomodcache, map[string]string{
+		"example.com/A": "v1.0.0",
+		"example.com/e": "v1.0.0",
+		"example.com/f": "v1.0.0",
+		"example.com/g": "latest",
+	})
+	expected := []string{
+		"example.com/d@v1.0.0",
+		"example.com/e@v1.0.0 (source)",
+		"example.com/f@v1.0.0",
+		"example.com/g@latest (list of versions)",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestOfflineProxy(t *testing.T) {
+	gomodcache := t.TempDir()
+	got := offlineProxy(gomodcache)
+	expected := "file://" + filepath.ToSlash(filepath.Join(gomodcache, "cache", "download"))
+	if filepath.VolumeName(gomodcache) != "" {
+		expected = "file:///" + filepath.ToSlash(filepath.Join(gomodcache, "cache", "download"))
+	}
+	if got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
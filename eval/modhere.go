@@ -0,0 +1,107 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dolmen-go/goeval/internal/procgroup"
+)
+
+// With [Options.ModHere], the code is built as a file of the working directory, inside the
+// Go module (or workspace) of the user, so it can import any package of the module, even
+// internal ones. The file doesn't exist on disk: it is provided to "go build" and "go vet"
+// with an overlay (see "go help build"), so nothing is written in the user's tree.
+
+// getGOMOD returns the path of the go.mod of the main module of the working directory, or
+// of the go.work of its Go workspace.
+func (p *Program) getGOMOD(ctx context.Context) (string, error) {
+	var out bytes.Buffer
+	cmd := procgroup.Command(ctx, p.opts.GoCmd, "env", "GOMOD", "GOWORK")
+	cmd.Stderr = p.stderr
+	cmd.Stdout = &out
+	cmd.Env = p.env
+	cmd.Dir = p.runDir
+	err := p.run(cmd)
+	if err != nil {
+		return "", err
+	}
+	gomod, gowork, _ := strings.Cut(strings.TrimRight(out.String(), "\r\n"), "\n")
+	gomod, gowork = strings.TrimSpace(gomod), strings.TrimSpace(gowork)
+	switch {
+	case gomod != "" && gomod != os.DevNull:
+		return gomod, nil
+	case gowork != "" && gowork != "off":
+		// Root of a Go workspace, outside of its modules
+		return gowork, nil
+	}
+	return "", errors.New("go.mod or go.work not found in the working directory or any parent directory")
+}
+
+// writeOverlay writes in dir an overlay file that makes the file srcFilename appear as filename.
+func writeOverlay(dir string, filename string, srcFilename string) (string, error) {
+	b, err := json.Marshal(struct {
+		Replace map[string]string
+	}{
+		Replace: map[string]string{filename: srcFilename},
+	})
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "goeval-overlay*.json")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(b)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// withoutModMod returns env without -mod=mod in GOFLAGS, so that the go command doesn't
+// update go.mod and go.sum of the user.
+// This is also required in workspace mode (go.work) where -mod=mod is not allowed.
+func withoutModMod(env []string) []string {
+	env = slices.Clone(env)
+	for i, kv := range env {
+		if goflags, ok := strings.CutPrefix(kv, "GOFLAGS="); ok {
+			env[i] = "GOFLAGS=" + strings.Join(slices.DeleteFunc(strings.Fields(goflags), func(f string) bool {
+				return f == "-mod=mod"
+			}), " ")
+		}
+	}
+	return env
+}
+
+// withModMod returns env with -mod=mod in GOFLAGS, keeping the other flags of the user.
+func withModMod(env []string) []string {
+	flags := slices.DeleteFunc(strings.Fields(lookupEnv(env, "GOFLAGS")), func(f string) bool {
+		return strings.HasPrefix(f, "-mod=")
+	})
+	return append(env, "GOFLAGS="+strings.Join(append(flags, "-mod=mod"), " "))
+}
@@ -0,0 +1,56 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test ModHere in the root directory of a Go workspace that is not a module.
+func TestModHereWorkspace(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"go.work":      "go 1.24\nuse ./a\n",
+		"a/go.mod":     "module example.com/a\ngo 1.24\n",
+		"a/pkg/pkg.go": "package pkg\nconst X = 42\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := Run(context.Background(), &Options{
+		Code:    `pkg.X`,
+		Print:   true,
+		Imports: []string{"example.com/a/pkg"},
+		Dir:     root,
+		ModHere: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 0 || string(res.Stdout) != "42\n" {
+		t.Errorf("exit %d: %q %q", res.ExitCode, res.Stdout, res.Stderr)
+	}
+}
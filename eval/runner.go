@@ -0,0 +1,110 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/dolmen-go/goeval/internal/procgroup"
+)
+
+// An executable built for another platform ([Options.GOOS], [Options.GOARCH]) is run through
+// a runner, like "go run -exec" does:
+//   - the command given with [Options.Exec]
+//   - or go_$GOOS_$GOARCH_exec found in PATH
+//   - or $GOROOT/lib/wasm/go_$GOOS_$GOARCH_exec (for js/wasm with Node.js, and wasip1/wasm)
+
+// targetEnv returns env with GOOS and GOARCH set for the target platform.
+func (opts *Options) targetEnv(env []string) []string {
+	if opts.GOOS != "" {
+		env = append(env, "GOOS="+opts.GOOS)
+	}
+	if opts.GOARCH != "" {
+		env = append(env, "GOARCH="+opts.GOARCH)
+	}
+	return env
+}
+
+// wasiRuntimes are the WASI runtimes supported by $GOROOT/lib/wasm/go_wasip1_wasm_exec,
+// in order of preference.
+var wasiRuntimes = []string{"wasmtime", "wazero", "wasmedge", "wasmer"}
+
+// lookupEnv returns the value of the environment variable name in env (last value wins).
+func lookupEnv(env []string, name string) string {
+	for _, kv := range slices.Backward(env) {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == name {
+			return v
+		}
+	}
+	return ""
+}
+
+// runner returns the command (with its arguments) that runs an executable built with env,
+// or nil if the executable runs natively. env may be updated for the runner.
+func (p *Program) runner(ctx context.Context, env []string) ([]string, []string, error) {
+	if p.opts.Exec != "" {
+		return strings.Fields(p.opts.Exec), env, nil
+	}
+	goos, goarch := lookupEnv(env, "GOOS"), lookupEnv(env, "GOARCH")
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+	if goos == runtime.GOOS && goarch == runtime.GOARCH {
+		return nil, env, nil
+	}
+
+	name := "go_" + goos + "_" + goarch + "_exec"
+	if path, err := exec.LookPath(name); err == nil {
+		return []string{path}, env, nil
+	}
+
+	var out bytes.Buffer
+	cmd := procgroup.Command(ctx, p.opts.GoCmd, "env", "GOROOT")
+	cmd.Env = env
+	cmd.Stdout = &out
+	cmd.Stderr = p.stderr
+	if err := p.run(cmd); err != nil {
+		return nil, env, err
+	}
+	path := filepath.Join(string(bytes.TrimRight(out.Bytes(), "\r\n")), "lib", "wasm", name)
+	if _, err := os.Stat(path); err != nil {
+		return nil, env, fmt.Errorf("no runner for %s/%s: use -exec or install %s in PATH", goos, goarch, name)
+	}
+	if goos == "wasip1" && lookupEnv(env, "GOWASIRUNTIME") == "" {
+		i := slices.IndexFunc(wasiRuntimes, func(rt string) bool {
+			_, err := exec.LookPath(rt)
+			return err == nil
+		})
+		if i < 0 {
+			return nil, env, errors.New("no WASI runtime found in PATH (" + strings.Join(wasiRuntimes, ", ") + "): use -exec")
+		}
+		env = append(env, "GOWASIRUNTIME="+wasiRuntimes[i])
+	}
+	return []string{path}, env, nil
+}
@@ -0,0 +1,107 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dolmen-go/goeval/internal/filelock"
+)
+
+// A workspace ([Options.Workspace]) is a module directory kept in the user cache directory across runs.
+// The arguments of the last successful "go get" are recorded in the workspace, so that a run
+// with the same set of modules reuses go.mod and go.sum without calling "go get" again.
+// The record is removed before go.mod is updated, so a failed "go get" is retried by the next run.
+// Concurrent runs in the same workspace are serialized by a lock file.
+
+// workspaceAuto is the workspace name that selects a workspace keyed by the set of modules.
+const workspaceAuto = "auto"
+
+// workspaceStamp is the file of the workspace which records the "go get" arguments.
+const workspaceStamp = "goeval-get.txt"
+
+// workspaceLock is the lock file of the workspace.
+const workspaceLock = "goeval.lock"
+
+var workspaceNameRe = regexp.MustCompile(`^[A-Za-z0-9_][-A-Za-z0-9_.]*$`)
+
+// workspacesDir returns the directory containing the workspaces.
+func workspacesDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "goeval", "workspace"), nil
+}
+
+// openWorkspace creates (if necessary) the workspace directory for the given "go get" arguments
+// and locks it until unlock is called.
+// upToDate reports if go.mod and go.sum have already been resolved for the same arguments.
+func openWorkspace(ctx context.Context, name string, gogetArgs []string) (dir string, upToDate bool, unlock func(), err error) {
+	stamp := strings.Join(gogetArgs, "\n") + "\n"
+	if name == workspaceAuto {
+		h := sha256.Sum256([]byte(stamp))
+		name = "auto-" + hex.EncodeToString(h[:8])
+	} else if !workspaceNameRe.MatchString(name) {
+		return "", false, nil, errors.New("invalid workspace name")
+	}
+	base, err := workspacesDir()
+	if err != nil {
+		return "", false, nil, err
+	}
+	dir = filepath.Join(base, name)
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return "", false, nil, err
+	}
+	if unlock, err = filelock.Lock(ctx, filepath.Join(dir, workspaceLock)); err != nil {
+		return "", false, nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+		return dir, false, unlock, nil
+	}
+	b, err := os.ReadFile(filepath.Join(dir, workspaceStamp))
+	return dir, err == nil && string(b) == stamp, unlock, nil
+}
+
+// invalidateWorkspace removes the record of the "go get" arguments, before go.mod is updated.
+func invalidateWorkspace(dir string) error {
+	err := os.Remove(filepath.Join(dir, workspaceStamp))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// saveWorkspace records the "go get" arguments that resolved go.mod and go.sum of the workspace.
+func saveWorkspace(dir string, gogetArgs []string) error {
+	return os.WriteFile(filepath.Join(dir, workspaceStamp), []byte(strings.Join(gogetArgs, "\n")+"\n"), 0o600)
+}
+
+// unlockWorkspace releases the lock of the workspace, once the program is built.
+func (p *Program) unlockWorkspace() {
+	if p.unlock != nil {
+		p.unlock()
+		p.unlock = nil
+	}
+}
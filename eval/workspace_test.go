@@ -0,0 +1,168 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkspace(t *testing.T) {
+	tmp := t.TempDir()
+	// os.UserCacheDir
+	t.Setenv("XDG_CACHE_HOME", tmp)
+	t.Setenv("HOME", tmp)
+	t.Setenv("LocalAppData", tmp)
+
+	args := []string{"example.com/a@v1.0.0", "example.com/b@v1.2.0"}
+
+	dir, upToDate, unlock, err := openWorkspace(t.Context(), "test", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upToDate {
+		t.Error("new workspace is up to date")
+	}
+	defer func() { unlock() }()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module goeval\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveWorkspace(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+	dir2, upToDate, unlock, err := openWorkspace(t.Context(), "test", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir2 != dir {
+		t.Errorf("got %q, expected %q", dir2, dir)
+	}
+	if !upToDate {
+		t.Error("workspace should be up to date")
+	}
+
+	unlock()
+	if _, upToDate, unlock, _ = openWorkspace(t.Context(), "test", args[:1]); upToDate {
+		t.Error("workspace should not be up to date with different modules")
+	}
+
+	autoA, _, unlockA, err := openWorkspace(t.Context(), workspaceAuto, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockA()
+	autoB, _, unlockB, err := openWorkspace(t.Context(), workspaceAuto, args[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockB()
+	if autoA == autoB {
+		t.Error("auto workspaces should differ for different modules")
+	}
+
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`, "-x"} {
+		if _, _, _, err := openWorkspace(t.Context(), name, args); err == nil {
+			t.Errorf("%q: error expected", name)
+		}
+	}
+}
+
+func TestWorkspaceLock(t *testing.T) {
+	tmp := t.TempDir()
+	// os.UserCacheDir
+	t.Setenv("XDG_CACHE_HOME", tmp)
+	t.Setenv("HOME", tmp)
+	t.Setenv("LocalAppData", tmp)
+
+	_, _, unlock, err := openWorkspace(t.Context(), "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := openWorkspace(ctx, "test", nil); err != context.DeadlineExceeded {
+		t.Errorf("got %v, expected the workspace to be locked", err)
+	}
+}
+
+// TestWorkspaceGetFailure checks that a workspace is resolved again after a "go get" failure.
+func TestWorkspaceGetFailure(t *testing.T) {
+	out, err := exec.Command("go", "env", "GOMODCACHE").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomodcache := string(bytes.TrimSpace(out))
+	if !inModCache(gomodcache, "golang.org/x/mod", "v0.26.0") {
+		t.Skip("golang.org/x/mod@v0.26.0 is not in the module cache")
+	}
+
+	tmp := t.TempDir()
+	// os.UserCacheDir
+	t.Setenv("XDG_CACHE_HOME", tmp)
+	t.Setenv("HOME", tmp)
+	t.Setenv("LocalAppData", tmp)
+	t.Setenv("GOMODCACHE", gomodcache)
+
+	assemble := func(imports ...string) error {
+		p, err := Assemble(t.Context(), &Options{
+			Code:      `semver.IsValid("v1.2.3")`,
+			Imports:   imports,
+			Print:     true,
+			Workspace: "test",
+			Offline:   true,
+		})
+		if err != nil {
+			return err
+		}
+		return p.Close()
+	}
+
+	if err := assemble("golang.org/x/mod@v0.26.0"); err != nil {
+		t.Fatal(err)
+	}
+	err = assemble("golang.org/x/mod@v0.26.0", "golang.org/x/mod@v0.26.0=>example.com/nonexist@v1.0.0")
+	if err == nil {
+		t.Fatal("error expected for a replacement by a missing module")
+	}
+	t.Log(err)
+	if err := assemble("golang.org/x/mod@v0.26.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, _, unlock, err := openWorkspace(t.Context(), "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	gomod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(gomod), "nonexist") {
+		t.Errorf("the replacement is still in go.mod:\n%s", gomod)
+	}
+}
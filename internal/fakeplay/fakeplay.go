@@ -0,0 +1,444 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package fakeplay implements an in-process fake of the Go Playground API
+// described in ../../sub/playground-openapi.yaml: /compile, /share, /p/{id}.go,
+// /fmt and /version.
+//
+// Programs are compiled and run with the local Go toolchain with the "faketime"
+// build tag, like on the real Go Playground: time starts at 2009-11-10 23:00:00 UTC
+// and sleeps are instantaneous.
+//
+// This allows to test "goeval -play", "goeval -share" and "goeval -fetch" without
+// network access:
+//
+//	srv := httptest.NewServer(fakeplay.New())
+//	defer srv.Close()
+//	os.Setenv("GOEVAL_PLAYGROUND", srv.URL)
+package fakeplay
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/imports"
+	"golang.org/x/tools/txtar"
+)
+
+const (
+	// maxSnippetSize is the limit for /share.
+	maxSnippetSize = 64 * 1024
+	// runTimeout is the limit of real time for running a program.
+	runTimeout = 10 * time.Second
+	// mainFile is the name of the Go source that precedes the first file marker in a txtar archive.
+	mainFile = "prog.go"
+)
+
+// epoch is the start time of programs built with -tags=faketime.
+var epoch = time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+// Server is a fake Go Playground. It implements [http.Handler].
+type Server struct {
+	// GoCmd is the go command used to build programs. Default: "go".
+	GoCmd string
+
+	mux      http.ServeMux
+	mu       sync.Mutex
+	snippets map[string][]byte
+}
+
+// New returns a new fake Go Playground.
+func New() *Server {
+	s := &Server{
+		GoCmd:    "go",
+		snippets: make(map[string][]byte),
+	}
+	s.mux.HandleFunc("/version", s.handleVersion)
+	s.mux.HandleFunc("POST /compile", s.handleCompile)
+	s.mux.HandleFunc("POST /share", s.handleShare)
+	s.mux.HandleFunc("GET /p/{file}", s.handleSnippet)
+	s.mux.HandleFunc("/fmt", s.handleFmt)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	version := runtime.Version()
+	release := version
+	// go1.24.2 => go1.24
+	if major, minor, ok := strings.Cut(strings.TrimPrefix(version, "go"), "."); ok {
+		minor, _, _ = strings.Cut(minor, ".")
+		release = "go" + major + "." + minor
+	}
+	writeJSON(w, map[string]string{
+		"Version": version,
+		"Release": release,
+		"Name":    "Go " + strings.TrimPrefix(release, "go"),
+	})
+}
+
+// Event is an output event of a program run on /compile.
+type Event struct {
+	Message string
+	Kind    string // "stdout" or "stderr"
+	Delay   time.Duration
+}
+
+// CompileResponse is the response of /compile.
+type CompileResponse struct {
+	Errors      string
+	Events      []Event
+	Status      int
+	IsTest      bool
+	TestsFailed int
+	VetErrors   string `json:",omitempty"`
+	VetOK       bool   `json:",omitempty"`
+}
+
+func (s *Server) handleCompile(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Body    string
+		WithVet bool
+	}
+	if r.Header.Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		req.Body = r.FormValue("body")
+		req.WithVet, _ = strconv.ParseBool(r.FormValue("withVet"))
+	}
+
+	resp, err := s.compileAndRun(r.Context(), []byte(req.Body), req.WithVet)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// parseArchive splits the body in files, with the conventions of the Go Playground.
+func parseArchive(body []byte) *txtar.Archive {
+	ar := txtar.Parse(body)
+	if len(bytes.TrimSpace(ar.Comment)) > 0 {
+		ar.Files = append([]txtar.File{{Name: mainFile, Data: ar.Comment}}, ar.Files...)
+	}
+	ar.Comment = nil
+	return ar
+}
+
+// isTest reports whether the Go source is a test program: no main func, but Test functions.
+func isTest(src []byte) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), mainFile, src, parser.SkipObjectResolution)
+	if err != nil {
+		return false
+	}
+	var hasTest bool
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil {
+			continue
+		}
+		if fn.Name.Name == "main" {
+			return false
+		}
+		hasTest = hasTest || strings.HasPrefix(fn.Name.Name, "Test")
+	}
+	return hasTest
+}
+
+// goExperiment extracts GOEXPERIMENT from a "// GOEXPERIMENT=" comment in the header of the source.
+func goExperiment(src []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(src))
+	for sc.Scan() {
+		line := sc.Text()
+		if exp, ok := strings.CutPrefix(line, "// GOEXPERIMENT="); ok {
+			return exp
+		}
+		if !strings.HasPrefix(line, "//") && strings.TrimSpace(line) != "" {
+			break
+		}
+	}
+	return ""
+}
+
+// cleanOutput removes the package header lines ("# command-line-arguments") of go build output.
+func cleanOutput(out []byte) string {
+	var b strings.Builder
+	for line := range strings.Lines(string(out)) {
+		if !strings.HasPrefix(line, "# ") {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+func (s *Server) compileAndRun(ctx context.Context, body []byte, withVet bool) (*CompileResponse, error) {
+	ar := parseArchive(body)
+	if len(ar.Files) == 0 {
+		return &CompileResponse{Errors: "empty program"}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "fakeplay*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var resp CompileResponse
+	var hasGoMod bool
+	for _, f := range ar.Files {
+		if !filepath.IsLocal(f.Name) {
+			return &CompileResponse{Errors: f.Name + ": invalid file name"}, nil
+		}
+		name := f.Name
+		switch name {
+		case "go.mod":
+			hasGoMod = true
+		case mainFile:
+			// Like the real Playground, a program without main but with tests is run as a test
+			if resp.IsTest = isTest(f.Data); resp.IsTest {
+				name = "prog_test.go"
+			}
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, f.Data, 0o600); err != nil {
+			return nil, err
+		}
+	}
+
+	env := append(os.Environ(), "GOEXPERIMENT="+goExperiment(ar.Files[0].Data))
+	if hasGoMod {
+		env = append(env, "GO111MODULE=on", "GOFLAGS=-mod=mod")
+	} else {
+		env = append(env, "GO111MODULE=off")
+	}
+
+	goCmd := func(args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, s.GoCmd, args...)
+		cmd.Dir = dir
+		cmd.Env = env
+		return cmd
+	}
+
+	// Like the real Playground, the program is run even if vet fails
+	if withVet {
+		out, err := goCmd("vet", ".").CombinedOutput()
+		resp.VetErrors = cleanOutput(out)
+		resp.VetOK = err == nil
+	}
+
+	exe := filepath.Join(dir, "prog.exe")
+	var build *exec.Cmd
+	if resp.IsTest {
+		build = goCmd("test", "-c", "-tags=faketime", "-o", exe, ".")
+	} else {
+		build = goCmd("build", "-tags=faketime", "-o", exe, ".")
+	}
+	if out, err := build.CombinedOutput(); err != nil {
+		resp.Errors = cleanOutput(out)
+		return &resp, nil
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+	var args []string
+	if resp.IsTest {
+		args = []string{"-test.v"}
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, exe, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case runCtx.Err() != nil:
+		resp.Errors = "timeout running program"
+	case errors.As(err, &exitErr):
+		resp.Status = exitErr.ExitCode()
+	case err != nil:
+		return nil, err
+	}
+
+	resp.Events = mergeEvents(decodePlayback("stdout", stdout.Bytes()), decodePlayback("stderr", stderr.Bytes()))
+	if resp.IsTest {
+		resp.TestsFailed = bytes.Count(stdout.Bytes(), []byte("--- FAIL:"))
+	}
+	return &resp, nil
+}
+
+// playbackHeader prefixes each write to stdout or stderr of programs built with -tags=faketime.
+// It is followed by the time (nanoseconds since Unix epoch) as an uint64 and the length
+// of the data as an uint32 (big endian).
+const playbackHeader = "\x00\x00PB"
+
+type timedEvent struct {
+	time int64
+	Event
+}
+
+// decodePlayback decodes the output of a program built with -tags=faketime.
+func decodePlayback(kind string, out []byte) []timedEvent {
+	var events []timedEvent
+	t := epoch.UnixNano()
+	for len(out) > 0 {
+		if len(out) < 16 || string(out[:4]) != playbackHeader {
+			// Not from faketime: all the remaining output is a single event
+			events = append(events, timedEvent{t, Event{Message: string(out), Kind: kind}})
+			break
+		}
+		t = int64(binary.BigEndian.Uint64(out[4:12]))
+		n := min(int(binary.BigEndian.Uint32(out[12:16])), len(out)-16)
+		out = out[16:]
+		events = append(events, timedEvent{t, Event{Message: string(out[:n]), Kind: kind}})
+		out = out[n:]
+	}
+	return events
+}
+
+// mergeEvents sorts the events by time and computes delays between them.
+func mergeEvents(stdout, stderr []timedEvent) []Event {
+	all := append(stdout, stderr...)
+	slices.SortStableFunc(all, func(a, b timedEvent) int {
+		return cmp.Compare(a.time, b.time)
+	})
+	events := make([]Event, len(all))
+	prev := epoch.UnixNano()
+	for i, ev := range all {
+		events[i] = ev.Event
+		events[i].Delay = time.Duration(ev.time - prev)
+		prev = ev.time
+	}
+	return events
+}
+
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSnippetSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(body) > maxSnippetSize {
+		http.Error(w, "Snippet is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	h := sha256.Sum256(body)
+	id := base64.RawURLEncoding.EncodeToString(h[:])[:11]
+
+	s.mu.Lock()
+	s.snippets[id] = body
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, id)
+}
+
+func (s *Server) handleSnippet(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(r.PathValue("file"), ".go")
+	s.mu.Lock()
+	snippet, found := s.snippets[id]
+	s.mu.Unlock()
+	if !ok || !found {
+		http.Error(w, "Snippet not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(snippet)
+}
+
+func (s *Server) handleFmt(w http.ResponseWriter, r *http.Request) {
+	var body string
+	var fixImports bool
+	if r.Header.Get("Content-Type") == "application/json" {
+		var req struct{ Body string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = req.Body
+	} else {
+		body = r.FormValue("body")
+		fixImports, _ = strconv.ParseBool(r.FormValue("imports"))
+	}
+
+	ar := parseArchive([]byte(body))
+	for i, f := range ar.Files {
+		var out []byte
+		var err error
+		switch {
+		case strings.HasSuffix(f.Name, ".go"):
+			out, err = imports.Process(f.Name, f.Data, &imports.Options{
+				Comments:   true,
+				TabIndent:  true,
+				TabWidth:   8,
+				FormatOnly: !fixImports,
+			})
+		case f.Name == "go.mod":
+			var mf *modfile.File
+			if mf, err = modfile.Parse(f.Name, f.Data, nil); err == nil {
+				out, err = mf.Format()
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			writeJSON(w, map[string]string{"Body": "", "Error": err.Error()})
+			return
+		}
+		ar.Files[i].Data = out
+	}
+	if len(ar.Files) > 0 && ar.Files[0].Name == mainFile {
+		ar.Comment, ar.Files = ar.Files[0].Data, ar.Files[1:]
+	}
+	writeJSON(w, map[string]string{"Body": string(txtar.Format(ar)), "Error": ""})
+}
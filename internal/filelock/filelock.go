@@ -0,0 +1,54 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package filelock provides an advisory lock on a file, to serialize the goeval processes
+// that update the same directory.
+package filelock
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// pollDelay is the delay between attempts to take a lock held by another process.
+const pollDelay = 50 * time.Millisecond
+
+// Lock takes an exclusive lock on the file name, which is created if necessary.
+// Lock waits until the lock is released by its holder, or until ctx is done.
+// The returned function releases the lock.
+func Lock(ctx context.Context, name string) (unlock func(), err error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, &os.PathError{Op: "lock", Path: name, Err: err}
+		}
+		if locked {
+			return func() { f.Close() }, nil
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, context.Cause(ctx)
+		case <-time.After(pollDelay):
+		}
+	}
+}
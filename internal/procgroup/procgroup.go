@@ -0,0 +1,67 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package procgroup runs commands that are killed, with all their child processes,
+// when their context is done. This matters for "go run" and for runners (-exec), which
+// start the actual program as a child process.
+package procgroup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// waitDelay is the delay for the I/O of a killed command to be closed.
+const waitDelay = time.Second
+
+// Command is like [exec.CommandContext], with the command set up by [Set].
+func Command(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, arg...)
+	Set(ctx, cmd)
+	return cmd
+}
+
+// Set sets up cmd, created with [exec.CommandContext] and ctx, to run in its own process
+// group which is killed when ctx is done (on Unix). Nothing is done if ctx can't be canceled.
+//
+// Set must be called after cmd.Stdin is set: a command that reads from a terminal stays in
+// the process group of goeval, to keep access to the terminal.
+func Set(ctx context.Context, cmd *exec.Cmd) {
+	if ctx.Done() == nil {
+		return
+	}
+	cmd.WaitDelay = waitDelay
+	if isTerminal(cmd.Stdin) {
+		return
+	}
+	setGroup(cmd)
+}
+
+// isTerminal reports if r is a character device other than os.DevNull.
+func isTerminal(r any) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
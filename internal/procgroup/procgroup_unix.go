@@ -0,0 +1,33 @@
+//go:build unix
+
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package procgroup
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setGroup runs cmd in a new process group, which is killed on cancel.
+func setGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		// The process group ID is the process ID of its leader
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -18,6 +18,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -25,193 +26,61 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
-	"golang.org/x/mod/module"
-	goimp "golang.org/x/tools/imports"
-)
-
-// imports is the storage for -i flags
-// imports implements interface flag.Value.
-type imports struct {
-	packages   map[string]string // alias => import path
-	modules    map[string]string // module path => version
-	onlySemVer bool
-}
-
-func (*imports) String() string {
-	return "" // irrelevant
-}
-
-func (imp *imports) Set(s string) error {
-	// Allow -i fmt,os
-	// Comma is not allowed in import path
-	if p1, remainder, ok := strings.Cut(s, ","); ok {
-		err := imp.Set(p1)
-		if err == nil {
-			imp.Set(remainder)
-		}
-		return err
-	}
-
-	// Optional aliasing with [alias=]import
-	var alias, path, version string
-	var ok bool
-	if alias, path, ok = strings.Cut(s, "="); !ok {
-		alias = ""
-		path = s
-	} else if alias == "" {
-		return fmt.Errorf("%q: empty alias", s)
-	} else if alias == "_" || alias == "." {
-		tmpPath, _, _ := strings.Cut(path, "@")
-		alias = alias + " " + tmpPath // special alias
-	} else if strings.Contains(alias, " ") {
-		return fmt.Errorf("%q: invalid alias", s)
-	}
-	var p2 string
-	if p2, version, ok = strings.Cut(path, "@"); ok {
-		if version == "" {
-			return fmt.Errorf("%q: empty module version", s)
-		}
-		path = p2
-		if err := module.CheckPath(path); err != nil {
-			return fmt.Errorf("%q: %w", s, err)
-		}
-		// TODO check for duplicates
-		if imp.modules == nil {
-			imp.modules = make(map[string]string)
-		}
-		imp.modules[path] = version
-		imp.onlySemVer = imp.onlySemVer && version == module.CanonicalVersion(version)
-	} else if alias == "" {
-		alias = "  " + path // special alias
-	}
-
-	switch path {
-	case "":
-		return fmt.Errorf("%q: empty path", s)
-	case "embed":
-		return errors.New("use of package 'embed' is not allowed")
-
-	default:
-		if err := module.CheckImportPath(path); err != nil {
-			return fmt.Errorf("%q: %w", s, err)
-		}
-	}
-
-	if alias != "" {
-		imp.packages[alias] = path
-	}
-
-	// log.Printf("alias=%s path=%s version=%s", alias, path, version)
+	"golang.org/x/tools/txtar"
 
-	return nil
-}
+	"github.com/dolmen-go/goeval/eval"
+)
 
 // Reference code for running the "go" command:
 // https://github.com/golang/dl/blob/master/internal/version/version.go#L58
 
-var run = runSilent
-
-func runSilent(cmd *exec.Cmd) error {
-	return cmd.Run()
-}
-
-func runX(cmd *exec.Cmd) error {
-	// Inject -x in go commands
-	if cmd.Args[0] == goCmd && cmd.Args[1] != "env" {
-		cmd.Args = append([]string{goCmd, cmd.Args[1], "-x"}, cmd.Args[2:]...)
+// runCmd runs a command of goeval itself (sub commands, comparison of toolchains).
+// With opts.ShowCmds (-x), the command is printed and -x is injected in go commands.
+func runCmd(opts *eval.Options, cmd *exec.Cmd) error {
+	if opts.ShowCmds {
+		// Inject -x in go commands
+		if cmd.Args[0] == opts.GoCmd && cmd.Args[1] != "env" {
+			cmd.Args = append([]string{opts.GoCmd, cmd.Args[1], "-x"}, cmd.Args[2:]...)
+		}
+		fmt.Printf("%s\n", cmd.Args)
 	}
-	fmt.Printf("%s\n", cmd.Args)
-	return cmd.Run()
-}
-
-func runTime(cmd *exec.Cmd) error {
-	defer func(start time.Time) {
-		fmt.Fprintf(os.Stderr, "run %v %v\n", time.Since(start), cmd.Args)
-	}(time.Now())
 	return cmd.Run()
 }
 
-func gorun(srcFilename string, env []string, buildDir string, runDir string, args ...string) error {
-	exePath := buildOutput
-	if exePath == "" {
-
-		exeDir, err := os.MkdirTemp("", "goeval*")
-		if err != nil {
-			return err
-		}
-
-		defer func() {
-			if err := os.RemoveAll(exeDir); err != nil {
-				log.Printf("RemoveAll(%q): %v", exeDir, err)
-			}
-		}()
-
-		exePath = filepath.Join(exeDir, "goeval-run")
-		if runtime.GOOS == "windows" {
-			exePath += ".exe"
-		}
-	}
-
-	cmdBuild := exec.Command(goCmd, "build",
-		// Do not embed VCS info:
-		// - there is nothing if fully built from temp dir (module mode)
-		// - or, if present, is not relevant for quick exec (GOPATH mode)
-		"-buildvcs=false",
-		// Trim paths because the paths of our ephemeral source files will not be helpful in a stack trace.
-		// This also hides goeval implementation details.
-		"-trimpath",
-
-		"-o", exePath,
-		srcFilename)
-	cmdBuild.Env = env
-	cmdBuild.Dir = buildDir
-	cmdBuild.Stdout = os.Stdout
-	cmdBuild.Stderr = os.Stderr
-	if err := run(cmdBuild); err != nil {
-		return fmt.Errorf("failed to build: %w", err)
-	}
-
-	// actionBuild: don't run
-	if buildOutput != "" {
-		return nil
+// exitStatus returns the exit status of the program as an [*exec.ExitError], handled by main.
+func exitStatus(res *eval.Result) error {
+	if res.ExitCode != 0 {
+		return &exec.ExitError{ProcessState: res.ProcessState}
 	}
-
-	cmdRun := exec.Command(exePath, args...)
-	cmdRun.Env = env
-	cmdRun.Dir = runDir // In Go module mode we run from the temp module dir
-	cmdRun.Stdin = os.Stdin
-	cmdRun.Stdout = os.Stdout
-	cmdRun.Stderr = os.Stderr
-	return run(cmdRun)
+	return nil
 }
 
-var goCmd = "go"
-
-func getGOMODCACHE(env []string) (string, error) {
-	var out bytes.Buffer
-	cmd := exec.Command(goCmd, "env", "GOMODCACHE")
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = &out
-	cmd.Env = env
-	err := run(cmd)
-	if err != nil {
-		return "", err
-	}
-	b := bytes.TrimRight(out.Bytes(), "\r\n")
-	if len(b) == 0 {
-		return "", errors.New("can't retrieve GOMODCACHE")
+// withTimeout returns the context of a phase ("resolve" or "run") of a sub command, limited by
+// timeout (-timeout) like the phases of eval.
+func withTimeout(ctx context.Context, timeout time.Duration, phase string) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
 	}
-	return string(b), nil
+	return context.WithTimeoutCause(ctx, timeout, &eval.TimeoutError{Phase: phase, Timeout: timeout})
 }
 
+// exitTimeout is the exit code of goeval when a phase exceeds -timeout, like the timeout
+// command of GNU coreutils.
+const exitTimeout = 124
+
 func main() {
 	err := _main()
-	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() > 0 {
+	var timeout *eval.TimeoutError
+	if errors.As(err, &timeout) {
+		log.Print(err)
+		os.Exit(exitTimeout)
+	} else if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() > 0 {
 		os.Exit(exit.ExitCode())
 	} else if err != nil {
 		log.Fatal(err)
@@ -234,6 +103,7 @@ const (
 var (
 	action      actionBits
 	buildOutput string // -o
+	fetchID     string // -fetch
 
 	errActionExclusive = errors.New("flags -o, -E, -Eplay, -play and -share are exclusive")
 )
@@ -252,16 +122,29 @@ func flagAction(name string, a actionBits, target *string, usage string) {
 }
 
 func _main() error {
-	imports := imports{
-		packages:   map[string]string{},
-		onlySemVer: true,
+	opts := eval.Options{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
 	}
-	flag.Var(&imports, "i", "* import package: [alias=]import-path\n* switch to Go module mode and import package: [alias=]import-path@version")
+
+	flag.Func("i", "* import package: [alias=]import-path\n* switch to Go module mode and import package: [alias=]import-path@version\n* import module from a local directory: [alias=]module-path[@version]=>./dir\n* replace a dependency: module-path[@version]=>module-path@version", func(value string) error {
+		if err := eval.CheckImport(value); err != nil {
+			return err
+		}
+		opts.Imports = append(opts.Imports, value)
+		return nil
+	})
+
+	flag.Func("d", "top-level declarations (types, functions...) to add to the package. Repeatable.", func(value string) error {
+		opts.Decls = append(opts.Decls, value)
+		return nil
+	})
 
 	var goimports string
-	flag.StringVar(&goimports, "goimports", "goimports", "goimports tool name, to use an alternate tool or just disable it.")
+	flag.StringVar(&goimports, "goimports", "goimports", "goimports tool name, to use an alternate tool or just disable it.\n\"play\" uses the formatter of the Go Playground.")
 
-	flag.StringVar(&goCmd, "go", "go", "go command path.")
+	flag.StringVar(&opts.GoCmd, "go", "go", "go command path.\nA comma-separated list of go commands or Go toolchains (go1.22.0, tip...) runs the code with each\nand compares the outputs.")
 
 	// -E, like "cc -E"
 	flagAction("E", actionDump, nil, "just dump the assembled source, without running it.")
@@ -269,6 +152,7 @@ func _main() error {
 
 	// -play, -share
 	registerOnlineFlags()
+	registerBuildFlags()
 
 	flag.Func("o", "just build a binary, don't execute.", func(value string) (err error) {
 		if action != actionDefault {
@@ -282,16 +166,81 @@ func _main() error {
 		return
 	})
 
-	showCmds := flag.Bool("x", false, "print commands executed.")
+	flag.BoolVar(&opts.ShowCmds, "x", false, "print commands executed.")
+
+	flag.Func("cache", "cache of built executables: on (default) or off.", func(value string) error {
+		switch value {
+		case "on":
+			opts.NoCache = false
+		case "off":
+			opts.NoCache = true
+		default:
+			return errors.New("on or off expected")
+		}
+		return nil
+	})
+	cacheClean := flag.Bool("cache-clean", false, "remove all executables from the cache, and exit.")
+
+	flag.DurationVar(&opts.Timeout, "timeout", 0, "maximum duration of each phase: resolution of modules, build and run (0: no limit).\nOn expiry, the commands are killed and goeval exits with code 124.")
+
+	flag.BoolVar(&opts.Vet, "vet", false, "check the code with \"go vet\" before running it (also with -play).")
+
+	flag.StringVar(&opts.Workspace, "workspace", "", "in module mode, keep the module in a persistent workspace with this name, to skip \"go get\" on later runs with the same modules.\n\"auto\" selects a workspace named from the set of modules.")
+
+	flag.BoolVar(&opts.Verbose, "v", false, "in module mode, print the selected version of each module (on stderr).")
+	flag.StringVar(&opts.Lock, "lock", "", "in module mode, lock file (txtar archive of go.mod and go.sum) to write after the resolution\nof module versions, or to read instead of resolving them if it exists.")
+
+	flag.BoolVar(&opts.Offline, "offline", false, "in module mode, resolve modules only from the local module cache (GOMODCACHE), without network.")
+
+	flag.Func("use", "switch to Go module mode in a Go workspace (go.work) that uses the module in this local directory. Repeatable.", func(value string) error {
+		dir, err := filepath.Abs(value)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+			return err
+		}
+		opts.Use = append(opts.Use, dir)
+		return nil
+	})
+
+	flag.StringVar(&opts.GOOS, "goos", "", "target operating system (GOOS) of the build.")
+	flag.StringVar(&opts.GOARCH, "goarch", "", "target architecture (GOARCH) of the build.")
+	flag.StringVar(&opts.Exec, "exec", "", "runner command for the executable (like \"go run -exec\").\nDefault for other platforms: go_$GOOS_$GOARCH_exec from PATH or $GOROOT/lib/wasm.")
+
+	testMode := flag.Bool("test", false, "run <code> as a test with \"go test\": the code is the body of func TestGoeval(t *testing.T).\nArguments are given to the test binary (-test.v, -test.run...).")
+	benchMode := flag.Bool("bench", false, "run <code> as a benchmark with \"go test\": the code is the body of func BenchmarkGoeval(b *testing.B),\nin a b.Loop() loop unless the code uses b.Loop() or b.N. Arguments are given to the test binary (-test.benchmem...).")
+
+	flag.Func("mod", "\"here\": build the code in the Go module (or workspace) of the current directory, to import its packages.", func(value string) error {
+		if value != "here" {
+			return errors.New(`"here" expected`)
+		}
+		opts.ModHere = true
+		return nil
+	})
+
+	replMode := flag.Bool("repl", false, "start an interactive session (REPL) where each input line is added to the program, which is run again.\nType :help in the session for help.")
+
+	var scriptName string
+	flag.StringVar(&scriptName, "f", "", "read <code> from a script file.\nThe first line may be a shebang (#!/usr/bin/env goeval) and can be followed by //goeval:<flag> [<value>] directives.")
+
+	var archiveName string
+	flag.StringVar(&archiveName, "txtar", "", "run the program from a txtar archive (\"-\" for stdin) such as produced by -E, -Eplay or go.dev/play.\nThe archive may contain multiple Go files, go.mod, go.sum and data files.")
+
+	printExpr := flag.Bool("p", false, "evaluate <code> as an expression and print its value(s).")
+
+	lineLoop := flag.Bool("n", false, "run <code> for each line of the files given as arguments (or stdin).\nVariables line, lineNum and fields are predeclared.")
+	printLines := flag.Bool("l", false, "like -n, but also print line after each iteration.")
 
 	flag.Usage = func() {
 		prog := os.Args[0]
 		fmt.Fprintf(flag.CommandLine.Output(), ""+
 			"\n"+
 			"Usage: %s [<options>...] <code> [<args>...]\n"+
+			"       %s [<options>...] -f <script> [<args>...]\n"+
 			"\n"+
 			"Options:\n",
-			prog)
+			prog, prog)
 		flag.PrintDefaults()
 		fmt.Fprintf(flag.CommandLine.Output(), ""+
 			"\n"+
@@ -305,273 +254,242 @@ func _main() error {
 	}
 	flag.Parse()
 
-	if flag.NArg() < 1 {
-		flag.Usage()
-	}
-	code := flag.Arg(0)
-	if code == "-" {
-		b, err := io.ReadAll(os.Stdin)
-		if err != nil {
-			return err
-		}
-		code = string(b)
+	if *cacheClean {
+		return eval.CleanCache()
 	}
 
-	args := flag.Args()[1:]
-	if len(args) > 0 {
-		switch action {
-		case actionBuild, actionDump:
-			return errors.New("arguments not expected")
+	if *replMode {
+		if flag.NArg() > 0 {
+			return errors.New("flag -repl: arguments not expected")
+		}
+		if action != actionRun || scriptName != "" || archiveName != "" || fetchID != "" || *printExpr || *lineLoop || *printLines || *testMode || *benchMode || strings.Contains(opts.GoCmd, ",") {
+			return errors.New("flag -repl excludes -o, -E, -Eplay, -play, -share, -f, -txtar, -fetch, -p, -n, -l, -test, -bench and -go with several toolchains")
 		}
 	}
 
-	if goCmdResolved, err := exec.LookPath(goCmd); err != nil {
-		return fmt.Errorf("%q: %v", goCmd, err)
-	} else {
-		goCmd = goCmdResolved
-	}
+	var (
+		code string
+		args []string
+		// codePos is the position of the code given in a //line directive.
+		codePos = ":1"
+		// stdin is the content of stdin, if the code was read from it.
+		stdin []byte
+	)
 
-	if *showCmds {
-		run = runX
+	if archiveName != "" && fetchID != "" {
+		return errors.New("flags -txtar and -fetch are exclusive")
 	}
+	archiveMode := archiveName != "" || fetchID != ""
 
-	moduleMode := imports.modules != nil
-
-	env := os.Environ()
-	if moduleMode {
-		env = append(env, "GO111MODULE=on")
+	// Script launched via a shebang: "#!/usr/bin/env goeval"
+	if !archiveMode && scriptName == "" && flag.NArg() > 0 && isScript(flag.Arg(0)) {
+		scriptName = flag.Arg(0)
+		args = flag.Args()[1:]
 	} else {
-		// Run in GOPATH mode, ignoring any code in the current directory
-		env = append(env, "GO111MODULE=off")
+		args = flag.Args()
 	}
 
-	var dir, origDir string
-
-	if moduleMode {
-		// "go get" is not yet as smart as we want, so let's help
-		// https://go.dev/issue/43646
-		preferCache := imports.onlySemVer
-		var gomodcache string
-		if preferCache {
-			var err error
-			gomodcache, err = getGOMODCACHE(env)
-			preferCache = err == nil
+	switch {
+	case archiveMode:
+		if scriptName != "" || opts.Imports != nil || opts.Decls != nil || *printExpr || *lineLoop || *printLines {
+			return errors.New("flags -txtar and -fetch exclude -f, -i, -d, -p, -n and -l")
 		}
-
+		if opts.ModHere || opts.Use != nil || opts.Workspace != "" || opts.Lock != "" {
+			return errors.New("flags -txtar and -fetch exclude -mod=here, -use, -workspace and -lock")
+		}
+	case *replMode: // No code
+	case scriptName != "":
+		var line int
 		var err error
-		if dir, err = os.MkdirTemp("", "goeval*"); err != nil {
-			log.Fatal(err)
+		if code, line, err = readScript(scriptName); err != nil {
+			return err
 		}
-		defer os.Remove(dir)
-
-		moduleName := filepath.Base(dir)
-
-		origDir, err = os.Getwd()
+		// Absolute path, as a relative path would be resolved from the directory of the temporary source
+		absName, err := filepath.Abs(scriptName)
 		if err != nil {
-			log.Fatal("getwd:", err)
-		}
-
-		gomod := dir + "/go.mod"
-		if err := os.WriteFile(gomod, []byte("module "+moduleName+"\n"), 0600); err != nil {
-			log.Fatal("go.mod:", err)
+			return err
 		}
-		defer os.Remove(gomod)
-
-		var gogetArgs []string
-		gogetArgs = append(gogetArgs, "get", "--")
-		for mod, ver := range imports.modules {
-			gogetArgs = append(gogetArgs, mod+"@"+ver)
-			if preferCache {
-				// Keep preferCache as long as we find modules in the cache.
-				// Structure of the cache is documented here: https://go.dev/ref/mod#module-cache
-				_, err := os.Stat(gomodcache + "/cache/download/" + mod + "/@v/" + ver + ".mod")
-				preferCache = err == nil
-			}
+		codePos = fmt.Sprintf("%s:%d", absName, line)
+	default:
+		if len(args) < 1 {
+			flag.Usage()
 		}
-		for _, path := range imports.packages {
-			if _, seen := imports.modules[path]; !seen {
-				gogetArgs = append(gogetArgs, path)
+		code = args[0]
+		if code == "-" {
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
 			}
+			code = string(b)
+			stdin = b
 		}
+		args = args[1:]
+	}
 
-		// fmt.Println("preferCache", preferCache)
-		if preferCache {
-			// As we found all modules in the cache, tell "go get" and "go run" to not use the proxy.
-			// See https://go.dev/issue/43646
-			// env = append(env, "GOPROXY=file://"+filepath.ToSlash(gomodcache)+"/cache/download")
-			env = append(env, "GOPROXY=off")
-		}
+	ctx := context.Background()
+
+	// A run of a comparison of toolchains
+	if cmd, ok := os.LookupEnv(toolchainEnv); ok {
+		opts.GoCmd = cmd
+		os.Unsetenv(toolchainEnv)
+	}
 
-		cmd := exec.Command(goCmd, gogetArgs...)
-		cmd.Env = env
-		cmd.Dir = dir
-		cmd.Stdin = nil
-		cmd.Stdout = nil
-		cmd.Stdout = os.Stdout
-		// go get is too verbose :(
-		cmd.Stderr = nil
-		if err = run(cmd); err != nil {
-			log.Fatal("go get failure:", err)
+	if strings.Contains(opts.GoCmd, ",") {
+		if action != actionRun {
+			return errors.New("flag -go with several toolchains excludes -o, -E, -Eplay, -play and -share")
 		}
-		// log.Println("go get OK.")
-		defer os.Remove(dir + "/go.sum")
+		// The input is read once, for all runs
+		if stdin == nil {
+			if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice == 0 {
+				var err error
+				if stdin, err = io.ReadAll(os.Stdin); err != nil {
+					return err
+				}
+			}
+		}
+		return compareToolchains(ctx, &opts, strings.Split(opts.GoCmd, ","), os.Args[1:], stdin)
 	}
 
-	var (
-		src        bytes.Buffer
-		injectArgs bool // inject our arguments into os.Args in the program source
-	)
+	if *printLines {
+		*lineLoop = true
+	}
 
-	// If sending to the Go Playground, export GOEXPERIMENT as a comment
-	if action >= actionDumpPlay {
-		const alphaNum = "abcdefghijklmnopqrstuvwxyz0123456789"
-		const alphaNumComma = alphaNum + ","
-		if exp, ok := os.LookupEnv("GOEXPERIMENT"); ok &&
-			exp != "" && // Not empty
-			strings.Trim(exp, ",") == exp && // No leading or trailing commas
-			strings.Trim(exp, alphaNumComma) == "" { // only lower case alpha num and comma
-			src.WriteString("// GOEXPERIMENT=")
-			src.WriteString(exp)
-			src.WriteString("\n\n")
-		}
+	if opts.Offline && (action >= actionPlay || fetchID != "") {
+		return errors.New("flag -offline excludes -play, -share and -fetch")
+	}
 
-		injectArgs = len(args) > 0
-		if injectArgs {
-			// We need the os package to patch os.Args
-			imports.Set("os")
-		}
+	if (goBuildFlags != nil || opts.GOOS != "" || opts.GOARCH != "" || opts.Exec != "") && action >= actionPlay {
+		return errors.New("build flags, -goos, -goarch and -exec are not supported with -play and -share")
 	}
 
-	src.WriteString("package main\n")
-	for alias, path := range imports.packages {
-		if len(alias) > 2 && alias[1] == ' ' {
-			switch alias[0] {
-			case '.', '_':
-				alias = alias[:1]
-			case ' ': // no alias
-				fmt.Fprintf(&src, "import %q\n", path)
-				continue
-			}
-		}
-		fmt.Fprintf(&src, "import %s %q\n", alias, path)
+	if *testMode && *benchMode {
+		return errors.New("flags -test and -bench are exclusive")
+	}
+	if (*testMode || *benchMode) && archiveMode {
+		return errors.New("flags -txtar and -fetch exclude -test and -bench")
 	}
-	if injectArgs {
-		fmt.Fprintf(&src, "func init() { os.Args = append(os.Args[:1], %#v...) }\n\n", args)
+	if *benchMode && action >= actionPlay {
+		// Time is fake in the sandbox of the Go Playground
+		return errors.New("flag -bench is not supported with -play and -share")
 	}
-	src.WriteString("func main() {\n")
-	if action <= actionDump {
-		src.WriteString("//line :1\n")
+	if playJSON && action != actionPlay {
+		return errors.New("flag -json requires -play")
 	}
-	src.WriteString(code)
-	src.WriteString("\n}\n")
 
-	var (
-		// srcFinal is the final transformed source after goimports.
-		// When in module mode AND dumping (-E, -Eplay) or sending to the Playground (-play, -share),
-		// this is not just the Go code, but a Txtar archive that includes go.mod and go.sum.
-		srcFinal io.Writer
-		// srcFilename is the full path to the srcFinal on disk that is needed by goimports to locate go.mod.
-		srcFilename string
-		// tail is the action that will process srcFinal.
-		tail func() error
-	)
-	switch action {
-	case actionRun, actionBuild:
-		f, err := os.CreateTemp(dir, "*.go")
-		if err != nil {
-			log.Fatal(err)
+	if len(args) > 0 {
+		switch action {
+		case actionBuild, actionDump:
+			return errors.New("arguments not expected")
 		}
-		defer f.Close()
-		defer os.Remove(f.Name())
-		srcFinal = f
-		srcFilename = f.Name()
+	}
 
-		tail = func() error {
-			if err = f.Close(); err != nil {
-				return err
-			}
-			return gorun(srcFilename, env, dir, origDir, args...)
-		}
-	case actionPlay:
-		var cleanup func()
-		srcFinal, tail, cleanup = prepareSubPlay()
-		defer cleanup()
-	case actionShare:
-		var cleanup func()
-		srcFinal, tail, cleanup = prepareSubShare()
-		defer cleanup()
-	default: // actionDump, actionDumpPlay
-		srcFinal = os.Stdout
-		tail = func() error { return nil }
+	if goCmd, err := exec.LookPath(opts.GoCmd); err != nil {
+		return fmt.Errorf("%q: %v", opts.GoCmd, err)
+	} else {
+		opts.GoCmd = goCmd
 	}
 
-	var err error
+	if opts.ModHere && action >= actionPlay {
+		return errors.New("flag -mod=here excludes -play and -share")
+	}
+
+	opts.Args = args
+	opts.BuildFlags = goBuildFlags
 	switch goimports {
-	case "goimports":
-		var out []byte
-		var filename string // filename is used to locate the relevant go.mod
-		if imports.packages != nil {
-			filename = srcFilename
-		}
-		out, err = goimp.Process(filename, src.Bytes(), &goimp.Options{
-			Fragment:   false,
-			AllErrors:  false,
-			Comments:   true,
-			TabIndent:  true,
-			TabWidth:   8,
-			FormatOnly: false,
-		})
-		if err == nil {
-			_, err = srcFinal.Write(out)
-		}
+	case "goimports": // library
 	case "":
-		_, err = srcFinal.Write(src.Bytes())
+		opts.Goimports = "off"
+	case "play":
+		opts.Format = func(ctx context.Context, src []byte, codeLine int) ([]byte, error) {
+			var out bytes.Buffer
+			err := playFmt(ctx, &opts, src, &out, codeLine)
+			return out.Bytes(), err
+		}
 	default:
-		cmd := exec.Command(goimports)
-		cmd.Env = env
-		cmd.Dir = dir
-		cmd.Stdin = &src
-		cmd.Stdout = srcFinal
-		cmd.Stderr = os.Stderr
-		err = run(cmd)
+		opts.Goimports = goimports
 	}
-	if err != nil {
-		return err
+
+	if *replMode {
+		return runREPL(ctx, opts, os.Stdin, os.Stdout)
 	}
 
-	/*
-		// Do we need to run "go get" again after "goimports"?
-		if moduleMode {
-			goget := exec.Command(goCmd, "get", ".")
-			goget.Env = env
-			goget.Dir = dir
-			goget.Stdout = os.Stdout
-			goget.Stderr = os.Stderr
-			run(goget)
-		}
-	*/
+	// Only with -timeout do the commands run in their own process group (see internal/procgroup),
+	// out of reach of the Ctrl-C of the terminal: kill them on interrupt.
+	// Without -timeout, the terminal sends the signal to goeval and to all the commands.
+	if opts.Timeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
 
-	// dump go.mod, go.sum
-	if moduleMode && action >= actionDump {
-		gomod, err := os.Open(dir + "/go.mod")
+	if archiveMode {
+		var ar *txtar.Archive
+		var err error
+		if fetchID != "" {
+			var b []byte
+			fetchCtx, cancel := withTimeout(ctx, opts.Timeout, "resolve")
+			defer cancel()
+			if b, err = fetchSnippet(fetchCtx, &opts, fetchID); err != nil {
+				return err
+			}
+			ar, err = parseArchive(b)
+		} else {
+			ar, err = readArchive(archiveName)
+		}
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		io.WriteString(srcFinal, "-- go.mod --\n")
-		defer gomod.Close()
-		io.Copy(srcFinal, gomod)
-
-		gosum, err := os.Open(dir + "/go.sum")
-		switch {
-		case errors.Is(err, os.ErrNotExist): // ignore
-		case err != nil:
-			log.Fatal(err)
-		default:
-			io.WriteString(srcFinal, "-- go.sum --\n")
-			defer gosum.Close()
-			io.Copy(srcFinal, gosum)
+		return runArchive(ctx, ar, &opts)
+	}
+
+	opts.Code = code
+	opts.CodePos = codePos
+	opts.Print = *printExpr
+	opts.Lines = *lineLoop
+	opts.PrintLines = *printLines
+	opts.Test = *testMode
+	opts.Bench = *benchMode
+	opts.Playground = action >= actionDumpPlay
+
+	p, err := eval.Assemble(ctx, &opts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	switch action {
+	case actionRun:
+		res, err := p.Run(ctx)
+		if err != nil {
+			return err
 		}
+		return exitStatus(res)
+	case actionBuild:
+		return p.Build(ctx, buildOutput)
 	}
 
-	return tail()
+	// When in module mode, this is not just the Go code, but a txtar archive that includes
+	// go.mod and go.sum.
+	ar, err := p.Archive()
+	if err != nil {
+		return err
+	}
+	// The program runs on the Go Playground
+	ctx, cancel := withTimeout(ctx, opts.Timeout, "run")
+	defer cancel()
+	switch action {
+	case actionPlay:
+		stdin, tail, cleanup := prepareSubPlay(ctx, &opts)
+		defer cleanup()
+		stdin.Write(txtar.Format(ar))
+		return tail()
+	case actionShare:
+		stdin, tail, cleanup := prepareSubShare(ctx, &opts)
+		defer cleanup()
+		stdin.Write(txtar.Format(ar))
+		return tail()
+	default: // actionDump, actionDumpPlay
+		_, err := os.Stdout.Write(txtar.Format(ar))
+		return err
+	}
 }
@@ -18,11 +18,23 @@ package main_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"golang.org/x/tools/txtar"
 )
 
 func goeval(args ...string) {
@@ -80,11 +92,137 @@ func Example_import() {
 	// 0001-01-01 00:00:00 +0000 UTC
 }
 
+func Example_print() {
+	goeval(`-p`, `1+2`)
+	goeval(`-p`, `"a", 1`)
+	goeval(`-p`, `strconv.Atoi("42")`) // nil error is not printed
+	goeval(`-p`, `strconv.Atoi("x")`)  // non-nil error is printed on stderr
+
+	// Output:
+	// 3
+	// a 1
+	// 42
+}
+
+func Example_lines() {
+	goeval(`-n`, `if lineNum == 1 { fmt.Println(fields[1]) }`, `go.mod`)
+	goeval(`-l`, `if lineNum > 1 { os.Exit(0) }; line = strings.ToUpper(line)`, `go.mod`)
+
+	// Output:
+	// github.com/dolmen-go/goeval
+	// MODULE GITHUB.COM/DOLMEN-GO/GOEVAL
+}
+
+func Example_decl() {
+	goeval(`-d`, `func fact(n int) int { if n <= 1 { return 1 }; return n*fact(n-1) }`, `-d`, `type pair[T any] struct{ a, b T }`, `fmt.Println(fact(5), pair[string]{"a", "b"})`)
+
+	// Output:
+	// 120 {a b}
+}
+
+func Example_script() {
+	goeval(`-f`, `testdata/hello.goeval`, `world`)
+	goeval(`testdata/hello.goeval`, `shebang`) // as launched by the shebang line
+
+	// Output:
+	// Hello, world!
+	// Hello, shebang!
+}
+
+func Example_txtar() {
+	goeval(`-txtar`, `testdata/hello.txtar`)
+
+	// Output:
+	// Hello world
+}
+
+func Example_vet() {
+	goeval(`-vet`, `fmt.Printf("%d\n", 42)`)
+	goeval(`-vet`, `fmt.Printf("%d\n", "x")`) // vet fails: not run
+
+	// Output:
+	// 42
+}
+
+func Example_modHere() {
+	// Import an internal package of the goeval module
+	goeval(`-mod=here`, `-p`, `fakeplay.New() != nil`)
+
+	// Output:
+	// true
+}
+
+func Example_replace() {
+	// Import a module from a local directory
+	goeval(`-i`, `example.com/greet=>./testdata/greet`, `-p`, `greet.Hello("Gopher")`)
+
+	// Output:
+	// Hello, Gopher!
+}
+
+func Example_use() {
+	// Go workspace with a module in a local directory
+	goeval(`-use`, `./testdata/greet`, `-p`, `greet.Hello("workspace")`)
+
+	// Output:
+	// Hello, workspace!
+}
+
+func Example_buildFlags() {
+	goeval(`-ldflags=-X main.version=v1.2.3`, `-d`, `var version = "devel"`, `-p`, `version`)
+	goeval(`-d`, `var version = "devel"`, `-p`, `version`) // Not from the cache
+
+	// Output:
+	// v1.2.3
+	// devel
+}
+
+func Example_test() {
+	goeval(`-test`, `if strings.Repeat("a", 2) != "aa" { t.Fatal("Repeat") }`)
+	goeval(`-test`, `t.Run("sub", func(t *testing.T) {})`, `-test.v`)
+
+	// Output:
+	// PASS
+	// === RUN   TestGoeval
+	// === RUN   TestGoeval/sub
+	// --- PASS: TestGoeval (0.00s)
+	//     --- PASS: TestGoeval/sub (0.00s)
+	// PASS
+}
+
+func Example_repl() {
+	cmd := exec.Command("go", "run", ".", "-repl")
+	cmd.Stdin = strings.NewReader(`x := 20
+x++
+fmt.Println("x =", x)
+x * 2
+:decl func double(n int) int { return 2 * n }
+:p double(x), x
+for i := range 2 {
+	fmt.Println("i =", i)
+}
+`)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Run()
+
+	// Output:
+	// x = 21
+	// 42
+	// 42 21
+	// i = 0
+	// i = 1
+}
+
 // printlnWriter writes each line to a [fmt.Println]-like function.
 // [testing.T.Log] is such a function.
 type printlnWriter func(...any)
 
+// Write always consumes the whole buffer: a short count would be an [io.ErrShortWrite] for
+// the io.Copy of [exec.Cmd], which would then close the pipe and break the output of goeval
+// (this was the case for the long output of -bench).
 func (tl printlnWriter) Write(b []byte) (int, error) {
+	n := len(b)
 	for len(b) > 0 {
 		p := bytes.IndexByte(b, '\n')
 		if p == -1 {
@@ -98,7 +236,7 @@ func (tl printlnWriter) Write(b []byte) (int, error) {
 		tl(string(line))
 		b = b[p+1:]
 	}
-	return len(b), nil
+	return n, nil
 }
 
 // goevalPrint runs goeval with the given arguments, and sends each line from standard output
@@ -155,3 +293,209 @@ func TestBuild(t *testing.T) {
 		t.Errorf(`output: got %q, expected "toto"`, out)
 	}
 }
+
+func TestArchiveFlags(t *testing.T) {
+	for _, flags := range [][]string{
+		{`-i`, `fmt`},
+		{`-mod=here`},
+		{`-use`, `.`},
+		{`-workspace`, `auto`},
+		{`-lock`, `goeval.lock`},
+	} {
+		out, err := exec.Command("go", slices.Concat([]string{"tool", "goeval", "-txtar", "-"}, flags)...).CombinedOutput()
+		if err == nil || !bytes.Contains(out, []byte("flags -txtar and -fetch exclude")) {
+			t.Errorf("%q: got %v %q, expected an error", flags, err, out)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "semver.lock")
+	// First run writes the lock file, the second one reads it
+	for range 2 {
+		goevalT(t, `-lock`, lockFile, `-i`, `golang.org/x/mod@v0.26.0`, `-p`, `semver.Max("v1.2.0", "v1.10.0")`)
+	}
+	ar, err := txtar.ParseFile(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ar.Comment) != "golang.org/x/mod@v0.26.0\n" {
+		t.Errorf("comment: got %q", ar.Comment)
+	}
+	if len(ar.Files) != 2 || ar.Files[0].Name != "go.mod" || ar.Files[1].Name != "go.sum" {
+		t.Errorf("unexpected files in lock file:\n%s", txtar.Format(ar))
+	}
+}
+
+func TestOffline(t *testing.T) {
+	goevalT(t, `-offline`, `-i`, `golang.org/x/mod@v0.26.0`, `-p`, `semver.IsValid("v1.2.3")`)
+
+	var stderr []string
+	goevalPrint(t.Error, func(args ...any) {
+		t.Log(args...)
+		stderr = append(stderr, fmt.Sprint(args...))
+	}, `-offline`, `-i`, `example.com/missing@v1.0.0`, `fmt.Println("not run")`)
+	if !slices.Contains(stderr, "\texample.com/missing@v1.0.0") {
+		t.Error("missing module not reported")
+	}
+}
+
+func TestCrossWasm(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not found: can't run GOOS=js GOARCH=wasm")
+	}
+	var stdout []string
+	goevalPrint(func(args ...any) {
+		stdout = append(stdout, fmt.Sprint(args...))
+	}, t.Error, `-goos=js`, `-goarch=wasm`, `-p`, `runtime.GOOS, runtime.GOARCH`)
+	if !slices.Equal(stdout, []string{"js wasm"}) {
+		t.Errorf("got %q", stdout)
+	}
+}
+
+func TestExec(t *testing.T) {
+	if _, err := exec.LookPath("env"); err != nil {
+		t.Skip("env not found")
+	}
+	var stdout []string
+	goevalPrint(func(args ...any) {
+		stdout = append(stdout, fmt.Sprint(args...))
+	}, t.Error, `-exec`, `env GOEVAL_RUNNER=env`, `-p`, `os.Getenv("GOEVAL_RUNNER"), os.Args[1:]`, `a`)
+	if !slices.Equal(stdout, []string{"env [a]"}) {
+		t.Errorf("got %q", stdout)
+	}
+}
+
+func TestBench(t *testing.T) {
+	var stdout []string
+	goevalPrint(func(args ...any) {
+		t.Log(args...)
+		stdout = append(stdout, fmt.Sprint(args...))
+	}, t.Error, `-bench`, `strconv.Itoa(42)`, `-test.benchtime=10x`)
+	if !slices.ContainsFunc(stdout, func(line string) bool {
+		return strings.HasPrefix(line, "BenchmarkGoeval")
+	}) {
+		t.Error("benchmark result not found")
+	}
+}
+
+func TestToolchains(t *testing.T) {
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout []string
+	goevalPrint(func(args ...any) {
+		t.Log(args...)
+		stdout = append(stdout, fmt.Sprint(args...))
+	}, t.Error, `-go`, `go,`+goCmd, `-p`, `runtime.GOOS`)
+	if len(stdout) != 3 || !strings.HasPrefix(stdout[0], "=== go (go") || stdout[1] != runtime.GOOS || !strings.HasSuffix(stdout[2], ", same output as go") {
+		t.Errorf("got %q", stdout)
+	}
+}
+
+// buildGoeval builds goeval in a temporary directory, to run it from other directories.
+func buildGoeval(tb testing.TB) string {
+	exe := filepath.Join(tb.TempDir(), "goeval")
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	if out, err := exec.Command("go", "build", "-o", exe, ".").CombinedOutput(); err != nil {
+		tb.Fatalf("go build: %v\n%s", err, out)
+	}
+	return exe
+}
+
+// Test a relative path given to -pgo: "go build" doesn't run in the current directory.
+func TestPGO(t *testing.T) {
+	exe := buildGoeval(t)
+
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "default.pgo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		t.Fatal(err)
+	}
+	pprof.StopCPUProfile()
+	f.Close()
+
+	// In module mode, the build runs in the directory of the temporary module
+	cmd := exec.Command(exe, `-pgo=default.pgo`, `-i`, `golang.org/x/mod@v0.26.0`, `-p`, `semver.IsValid("v1.2.3")`)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil || string(out) != "true\n" {
+		t.Errorf("%v: %s", err, out)
+	}
+}
+
+// runTimeout runs goeval with -timeout and checks that it exits with code 124.
+// It returns the output of goeval.
+func runTimeout(t *testing.T, exe string, env []string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(exe, append([]string{`-timeout`, `2s`}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	start := time.Now()
+	err := cmd.Run()
+	t.Logf("%v: %s", time.Since(start), out.Bytes())
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != 124 {
+		t.Errorf("got %v, expected exit status 124", err)
+	}
+	return out.String()
+}
+
+// processAlive reports whether the process is running (not a zombie).
+func processAlive(pid int) bool {
+	if b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		_, state, _ := strings.Cut(string(b), ") ")
+		return !strings.HasPrefix(state, "Z")
+	}
+	p, err := os.FindProcess(pid)
+	return err == nil && p.Signal(syscall.Signal(0)) == nil
+}
+
+func TestTimeoutRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are not supported on Windows")
+	}
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found")
+	}
+	exe := buildGoeval(t)
+
+	// The program and its child process must be killed
+	out := runTimeout(t, exe, nil, `cmd := exec.Command("sleep", "60"); cmd.Start(); fmt.Println(cmd.Process.Pid); cmd.Wait()`)
+	if !strings.Contains(out, "run: timeout after 2s") {
+		t.Error("timeout not reported")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(strings.SplitN(out, "\n", 2)[0]))
+	if err != nil {
+		t.Fatalf("pid: %v", err)
+	}
+	if processAlive(pid) {
+		if p, err := os.FindProcess(pid); err == nil {
+			p.Kill()
+		}
+		t.Errorf("the child process %d of the program is still running", pid)
+	}
+}
+
+func TestTimeoutResolve(t *testing.T) {
+	// A module proxy that never responds
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	exe := buildGoeval(t)
+	out := runTimeout(t, exe, []string{"GOPROXY=" + srv.URL, "GOSUMDB=off", "GOFLAGS="},
+		`-i`, `example.com/hang@v1.0.0`, `hang.Hang()`)
+	if !strings.Contains(out, "resolve: timeout after 2s") {
+		t.Error("timeout not reported")
+	}
+}
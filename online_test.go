@@ -18,6 +18,29 @@
 
 package main_test
 
+import (
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/dolmen-go/goeval/internal/fakeplay"
+)
+
+// TestMain runs the tests against a local fake of the Go Playground,
+// unless GOEVAL_PLAYGROUND is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("GOEVAL_PLAYGROUND") != "" {
+		os.Exit(m.Run())
+	}
+	srv := httptest.NewServer(fakeplay.New())
+	os.Setenv("GOEVAL_PLAYGROUND", srv.URL)
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
 // Show "goeval -play": running code remotely on https://play.golang.org/
 func Example_play() {
 	goeval(`-play`, `fmt.Println(time.Now())`)
@@ -33,3 +56,74 @@ func Example_playWithArgs() {
 	// Output:
 	// toto
 }
+
+// Show "goeval -play -n": input is sent with the program code
+func Example_playLines() {
+	goeval(`-play`, `-n`, `if lineNum == 1 { fmt.Println(fields[1]) }`, `go.mod`)
+
+	// Output:
+	// github.com/dolmen-go/goeval
+}
+
+// Show "goeval -play -vet": vet is run by the Go Playground
+func Example_playVet() {
+	goeval(`-play`, `-vet`, `fmt.Printf("%d\n", 42)`)
+	goeval(`-play`, `-vet`, `fmt.Printf("%d\n", "x")`) // vet fails: output not shown
+
+	// Output:
+	// 42
+}
+
+func Example_playTest() {
+	goeval(`-play`, `-test`, `if strings.Repeat("a", 2) != "aa" { t.Fatal("Repeat") }`)
+
+	// Output:
+	// === RUN   TestGoeval
+	// --- PASS: TestGoeval (0.00s)
+	// PASS
+}
+
+// Show "goeval -play -json": events as JSON lines, without delays
+func Example_playJSON() {
+	goeval(`-play`, `-json`, `fmt.Println("a"); time.Sleep(time.Second); fmt.Println("b")`)
+
+	// Output:
+	// {"Kind":"stdout","Message":"a\n"}
+	// {"Kind":"stdout","Message":"b\n","Delay":1000000000}
+	// {"Kind":"status","Status":0}
+}
+
+// Show "goeval -goimports=play": the code is formatted by the Go Playground
+func Example_goimportsPlay() {
+	goeval(`-goimports=play`, `-Eplay`, `fmt.Println(time.Now())`)
+
+	// Output:
+	// package main
+	//
+	// import (
+	// 	"fmt"
+	// 	"time"
+	// )
+	//
+	// func main() {
+	// 	fmt.Println(time.Now())
+	// }
+}
+
+// Test "goeval -share" and "goeval -fetch" roundtrip.
+func TestShareFetch(t *testing.T) {
+	out, err := exec.Command("go", "tool", "goeval", "-share", `fmt.Println("shared")`).Output()
+	if err != nil {
+		t.Fatal("share:", err)
+	}
+	url := strings.TrimSpace(string(out))
+	t.Log("URL:", url)
+
+	out, err = exec.Command("go", "tool", "goeval", "-fetch", url).Output()
+	if err != nil {
+		t.Fatal("fetch:", err)
+	}
+	if string(out) != "shared\n" {
+		t.Errorf("got %q, expected %q", out, "shared\n")
+	}
+}
@@ -0,0 +1,329 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/txtar"
+
+	"github.com/dolmen-go/goeval/eval"
+)
+
+// In a REPL session (-repl), each input line is added to the program: imports (-i),
+// top-level declarations (-d) or statements of main. The program is run again from the
+// start (with the same options as the session) and only the new output is shown.
+// An input that fails (build error, non-zero exit) is not kept in the session.
+
+const replHelp = `Enter Go statements, or expressions to print (the results of calls are printed too). Commands:
+  :p <expression>,...                         print values (not kept in the session)
+  :import [alias=]import-path[@version],...   import packages (see -i)
+  :decl <declaration>                         add a top-level declaration (see -d)
+  :reset                                      clear the session
+  :dump                                       show the source of the program (see -E)
+  :history                                    list the inputs of the session
+  :help                                       show this help
+  :quit                                       exit (or EOF)
+`
+
+// A replSession is the state of a REPL session.
+type replSession struct {
+	opts    eval.Options // options of goeval, for each run
+	imports []string     // -i
+	decls   []string     // -d
+	stmts   []string     // body of main
+	history []string     // inputs kept in the session
+	output  []byte       // output of the program of the session
+}
+
+// options returns the options of the program of the session with the given additional statements.
+func (s *replSession) options(stmts ...string) *eval.Options {
+	opts := s.opts
+	opts.Imports = slices.Concat(opts.Imports, s.imports)
+	opts.Decls = slices.Concat(opts.Decls, s.decls)
+	opts.Code = strings.Join(slices.Concat(s.stmts, stmts), "\n")
+	return &opts
+}
+
+// runProgram runs the program of the session with the given additional statements,
+// and returns the output (stdout and stderr, and the error of the build), if the run
+// succeeded and if the program was built.
+func (s *replSession) runProgram(ctx context.Context, stmts ...string) (output []byte, ok bool, built bool) {
+	var out bytes.Buffer
+	opts := s.options(stmts...)
+	opts.Stdin = nil
+	opts.Stdout = &out
+	opts.Stderr = &out
+	res, err := eval.Run(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(&out, err)
+		return out.Bytes(), false, res != nil
+	}
+	return out.Bytes(), res.ExitCode == 0, true
+}
+
+// newOutput returns the output that the program of the session hasn't shown yet.
+func (s *replSession) newOutput(output []byte) []byte {
+	if bytes.HasPrefix(output, s.output) {
+		return output[len(s.output):]
+	}
+	return output
+}
+
+// print prints the values of expressions, but they are not kept in the session.
+func (s *replSession) print(ctx context.Context, out io.Writer, exprs string) {
+	output, _, _ := s.runProgram(ctx, "fmt.Println("+exprs+")")
+	out.Write(s.newOutput(output))
+}
+
+// dump shows the source of the program of the session.
+func (s *replSession) dump(ctx context.Context, out io.Writer) error {
+	p, err := eval.Assemble(ctx, s.options())
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	ar, err := p.Archive()
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(txtar.Format(ar))
+	return err
+}
+
+// replParse parses an input line, which is either an expression (expr is not nil) or
+// statements. For statements, used lists the variables declared, to avoid "declared and
+// not used" errors.
+func replParse(line string) (expr ast.Expr, used []string, err error) {
+	if expr, err := parser.ParseExpr(line); err == nil {
+		return expr, nil, nil
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package main\nfunc main() {\n"+line+"\n}\n", parser.SkipObjectResolution)
+	if err != nil {
+		var list scanner.ErrorList
+		if errors.As(err, &list) && len(list) > 0 {
+			return nil, nil, errors.New("syntax error: " + list[0].Msg)
+		}
+		return nil, nil, err
+	}
+	addIdents := func(exprs []ast.Expr) {
+		for _, e := range exprs {
+			if id, ok := e.(*ast.Ident); ok && id.Name != "_" {
+				used = append(used, id.Name)
+			}
+		}
+	}
+	for _, stmt := range f.Decls[0].(*ast.FuncDecl).Body.List {
+		switch stmt := stmt.(type) {
+		case *ast.AssignStmt:
+			if stmt.Tok == token.DEFINE {
+				addIdents(stmt.Lhs)
+			}
+		case *ast.DeclStmt:
+			if gen, ok := stmt.Decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+				for _, spec := range gen.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						addIdents([]ast.Expr{name})
+					}
+				}
+			}
+		}
+	}
+	return nil, used, nil
+}
+
+// replIsFmtPrint reports whether the call is a call of a print function of package fmt,
+// whose results (the number of bytes written and the error) are not worth printing.
+func replIsFmtPrint(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "fmt" && (strings.HasPrefix(sel.Sel.Name, "Print") || strings.HasPrefix(sel.Sel.Name, "Fprint"))
+}
+
+// replIncomplete reports whether the input has unclosed brackets, so more lines are expected.
+func replIncomplete(input string) bool {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(input)), []byte(input), nil, 0)
+	depth := 0
+	for {
+		_, tok, _ := s.Scan()
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.EOF:
+			return depth > 0
+		}
+	}
+}
+
+// runREPL runs a REPL session, reading inputs from in.
+// opts are the options of goeval given to each run of the program.
+func runREPL(ctx context.Context, opts eval.Options, in io.Reader, out io.Writer) error {
+	s := replSession{opts: opts}
+
+	// Show prompts only to a human
+	interactive := false
+	if f, ok := in.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			interactive = true
+			io.WriteString(out, "Type :help for help.\n")
+		}
+	}
+	prompt := func(p string) {
+		if interactive {
+			io.WriteString(out, p)
+		}
+	}
+
+	sc := bufio.NewScanner(in)
+	for prompt("goeval> "); sc.Scan(); prompt("goeval> ") {
+		input := sc.Text()
+		for replIncomplete(input) {
+			prompt("...     ")
+			if !sc.Scan() {
+				break
+			}
+			input += "\n" + sc.Text()
+		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(input), " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case ":quit", ":q", ":exit":
+			return nil
+		case ":help", ":h":
+			io.WriteString(out, replHelp)
+			continue
+		case ":reset":
+			s = replSession{opts: opts}
+			continue
+		case ":history":
+			for _, h := range s.history {
+				fmt.Fprintln(out, h)
+			}
+			continue
+		case ":dump":
+			if err := s.dump(ctx, out); err != nil {
+				fmt.Fprintf(out, "%s: %v\n", cmd, err)
+			}
+			continue
+		case ":p":
+			s.print(ctx, out, arg)
+			continue
+		case ":import":
+			// Check the syntax
+			if err := eval.CheckImport(arg); err != nil {
+				fmt.Fprintf(out, "%s: %v\n", cmd, err)
+				continue
+			}
+			// Check that the imports are available
+			s.imports = append(s.imports, arg)
+			output, ok, _ := s.runProgram(ctx)
+			if !ok {
+				out.Write(s.newOutput(output))
+				s.imports = s.imports[:len(s.imports)-1]
+				continue
+			}
+			out.Write(s.newOutput(output))
+			s.output = output
+		case ":decl":
+			s.decls = append(s.decls, arg)
+			output, ok, _ := s.runProgram(ctx)
+			if !ok {
+				out.Write(s.newOutput(output))
+				s.decls = s.decls[:len(s.decls)-1]
+				continue
+			}
+			out.Write(s.newOutput(output))
+			s.output = output
+		default:
+			if strings.HasPrefix(cmd, ":") {
+				fmt.Fprintf(out, "%s: unknown command (see :help)\n", cmd)
+				continue
+			}
+			expr, used, err := replParse(input)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			var exprSrc string // the expression without comments
+			if expr != nil {
+				var b bytes.Buffer
+				if err := format.Node(&b, token.NewFileSet(), expr); err != nil {
+					fmt.Fprintln(out, err)
+					continue
+				}
+				exprSrc = b.String()
+			}
+			call, isCall := ast.Unparen(expr).(*ast.CallExpr)
+			if expr != nil && !isCall {
+				s.print(ctx, out, exprSrc)
+				continue
+			}
+			if isCall && !replIsFmtPrint(call) {
+				// The results of a call are printed. The call is kept in the session,
+				// for its side effects. A call without results fails to build: it is
+				// run as a statement.
+				stmt := "fmt.Println(" + exprSrc + ")"
+				if output, ok, built := s.runProgram(ctx, stmt); built {
+					out.Write(s.newOutput(output))
+					if ok {
+						s.stmts = append(s.stmts, stmt)
+						s.output = output
+						s.history = append(s.history, input)
+					}
+					continue
+				}
+			}
+			stmt := input
+			for _, v := range used {
+				stmt += "\n_ = " + v
+			}
+			output, ok, _ := s.runProgram(ctx, stmt)
+			out.Write(s.newOutput(output))
+			if !ok {
+				continue
+			}
+			s.stmts = append(s.stmts, stmt)
+			s.output = output
+		}
+		s.history = append(s.history, input)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,47 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dolmen-go/goeval/eval"
+)
+
+func TestREPLCalls(t *testing.T) {
+	in := strings.Join([]string{
+		`s := "hello"`,
+		`strings.ToUpper(s) // comment`,
+		`len(s)`,
+		`fmt.Println("x =", 1)`,
+		`var b strings.Builder`,
+		`b.WriteString("ab")`,
+		`b.Len()`,
+		`func() {}()`,
+	}, "\n")
+	var out strings.Builder
+	if err := runREPL(t.Context(), eval.Options{}, strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	// The results of calls are printed, except for the print functions of fmt.
+	// Calls are kept in the session for their side effects.
+	const expected = "HELLO\n5\nx = 1\n2 <nil>\n2\n"
+	if out.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A script file (see -f) has the following structure:
+//   - an optional shebang line: "#!/usr/bin/env goeval"
+//   - optional header directives, one per line: "//goeval:<flag> [<value>]".
+//     Each directive sets the flag as if it was given on the command line.
+//   - the code.
+const directivePrefix = "//goeval:"
+
+// isScript reports whether the file exists and starts with a shebang ("#!").
+// This allows to run scripts with just "#!/usr/bin/env goeval" as first line.
+func isScript(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var magic [2]byte
+	_, err = io.ReadFull(f, magic[:])
+	return err == nil && string(magic[:]) == "#!"
+}
+
+// readScript reads a script file, applies its header directives to the command-line
+// flags and returns the code and the line number of the code in the file.
+func readScript(name string) (code string, line int, err error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", 0, err
+	}
+
+	line = 1
+	nextLine := func() string {
+		l, remainder, _ := bytes.Cut(b, []byte{'\n'})
+		b = remainder
+		line++
+		return string(bytes.TrimSuffix(l, []byte{'\r'}))
+	}
+
+	if bytes.HasPrefix(b, []byte("#!")) {
+		nextLine()
+	}
+
+	for bytes.HasPrefix(b, []byte(directivePrefix)) {
+		directiveLine := line
+		flagName, value, hasValue := strings.Cut(strings.TrimPrefix(nextLine(), directivePrefix), " ")
+		if err := applyDirective(flagName, strings.TrimSpace(value), hasValue); err != nil {
+			return "", 0, fmt.Errorf("%s:%d: %v", name, directiveLine, err)
+		}
+	}
+
+	return string(b), line, nil
+}
+
+// applyDirective sets a flag from a script header directive.
+func applyDirective(name, value string, hasValue bool) error {
+	if name == "f" {
+		return fmt.Errorf("%s%s: not allowed in a script", directivePrefix, name)
+	}
+	f := flag.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("%s%s: unknown flag", directivePrefix, name)
+	}
+	if !hasValue {
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+			value = "true"
+		} else {
+			return fmt.Errorf("%s%s: missing value", directivePrefix, name)
+		}
+	}
+	return flag.Set(name, value)
+}
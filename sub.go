@@ -20,17 +20,32 @@ package main
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
+	"flag"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"strconv"
+
+	"github.com/dolmen-go/goeval/eval"
+	"github.com/dolmen-go/goeval/internal/procgroup"
 )
 
+// playgroundURL is the endpoint of the Go Playground (-playground).
+// If empty, the sub commands use $GOEVAL_PLAYGROUND or https://play.golang.org.
+var playgroundURL string
+
+// playJSON is set by -json.
+var playJSON bool
+
 func registerOnlineFlags() {
-	// TODO allow to optionally set a different endpoint
+	flag.StringVar(&playgroundURL, "playground", "", "base URL of the Go Playground API for -play, -share and -fetch.\nDefault: $GOEVAL_PLAYGROUND or https://play.golang.org")
 	flagAction("play", actionPlay, nil, "run the code remotely on https://go.dev/play")
+	flag.BoolVar(&playJSON, "json", false, "with -play, output the events from the Go Playground as JSON lines, without delays.")
 	flagAction("share", actionShare, nil, "share the code on https://go.dev/play and print the URL.")
+	flag.StringVar(&fetchID, "fetch", "", "fetch the snippet (id or URL) shared on https://go.dev/play to run it locally.\nThe snippet may be a txtar archive (see -txtar).")
 }
 
 var (
@@ -38,22 +53,56 @@ var (
 	playClient string
 	//go:embed sub/share/share.go
 	shareClient string
+	//go:embed sub/fetch/fetch.go
+	fetchClient string
+	//go:embed sub/fmt/fmt.go
+	fmtClient string
 )
 
 // prepareSubPlay prepare the source code for compilation and execution of sub/play/play.go.
-func prepareSubPlay() (stdin *bytes.Buffer, tail func() error, cleanup func()) {
-	return prepareSub(playClient)
+func prepareSubPlay(ctx context.Context, opts *eval.Options) (stdin *bytes.Buffer, tail func() error, cleanup func()) {
+	var args []string
+	if opts.Vet {
+		args = append(args, "-vet")
+	}
+	if playJSON {
+		args = append(args, "-json")
+	}
+	return prepareSub(ctx, opts, playClient, os.Stdout, args...)
 }
 
 // prepareSubPlay prepare the source code for compilation and execution of sub/share/share.go.
-func prepareSubShare() (stdin *bytes.Buffer, tail func() error, cleanup func()) {
-	return prepareSub(shareClient)
+func prepareSubShare(ctx context.Context, opts *eval.Options) (stdin *bytes.Buffer, tail func() error, cleanup func()) {
+	return prepareSub(ctx, opts, shareClient, os.Stdout)
+}
+
+// playFmt formats the source and fixes imports with the Go Playground using sub/fmt/fmt.go.
+// codeLine is the line of the snippet in src, to report errors relative to the snippet.
+func playFmt(ctx context.Context, opts *eval.Options, src []byte, out io.Writer, codeLine int) error {
+	stdin, tail, cleanup := prepareSub(ctx, opts, fmtClient, out, strconv.Itoa(codeLine))
+	defer cleanup()
+	stdin.Write(src)
+	return tail()
+}
+
+// fetchSnippet retrieves the snippet from the Go Playground using sub/fetch/fetch.go.
+func fetchSnippet(ctx context.Context, opts *eval.Options, idOrURL string) ([]byte, error) {
+	var out bytes.Buffer
+	_, tail, cleanup := prepareSub(ctx, opts, fetchClient, &out, idOrURL)
+	defer cleanup()
+	if err := tail(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
 }
 
 // prepareSub prepares execution of a sub command via a "go run".
-// The returned stdin buffer may be filled with data.
+// The returned stdin buffer may be filled with data. args are given to the
+// command after the userAgent.
 // cleanup must be called after cmd.Run() to clean the tempoary go source created.
-func prepareSub(appCode string) (stdin *bytes.Buffer, tail func() error, cleanup func()) {
+// The "go run" command and the sub command are killed when ctx is done.
+// opts gives the go command (-go) and -x.
+func prepareSub(ctx context.Context, opts *eval.Options, appCode string, stdout io.Writer, args ...string) (stdin *bytes.Buffer, tail func() error, cleanup func()) {
 	f, err := os.CreateTemp("", "*.go")
 	if err != nil {
 		log.Fatal(err)
@@ -72,18 +121,26 @@ func prepareSub(appCode string) (stdin *bytes.Buffer, tail func() error, cleanup
 	stdin = new(bytes.Buffer)
 
 	// Run "go run" with the code submitted on stdin and the userAgent as first argument
-	cmd := exec.Command(goCmd, "run", fName, getUserAgent())
+	cmd := exec.CommandContext(ctx, opts.GoCmd, append([]string{"run", fName, getUserAgent()}, args...)...)
 	cmd.Env = append(
 		os.Environ(),      // We must not use the 'env' built for local run here
 		"GO111MODULE=off", // Sub command use only stdlib
 		"GOEXPERIMENT=",   // Clear GOEXPERIMENT which has been forwarded in a comment
 	)
+	if playgroundURL != "" {
+		cmd.Env = append(cmd.Env, "GOEVAL_PLAYGROUND="+playgroundURL)
+	}
 	cmd.Stdin = stdin
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = stdout
 	cmd.Stderr = os.Stderr
+	procgroup.Set(ctx, cmd)
 
 	tail = func() error {
-		return run(cmd)
+		err := runCmd(opts, cmd)
+		if err != nil && ctx.Err() != nil {
+			return context.Cause(ctx) // Timeout
+		}
+		return err
 	}
 	return
 }
@@ -0,0 +1,23 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Command fetch is the sub command launched by "goeval -fetch".
+//
+// fetch retrieves a snippet shared on the Go Playground and writes it on stdout.
+// The snippet is given either as an id or as an URL such as https://go.dev/play/p/<id>.
+//
+//	$ curl -s https://play.golang.org/p/<id>.go
+package main
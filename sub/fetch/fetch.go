@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+type uaTransport struct {
+	rt        http.RoundTripper
+	UserAgent string
+}
+
+func (t *uaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", t.UserAgent)
+	return t.rt.RoundTrip(req)
+}
+
+// endpoint returns the base URL of the Go Playground, which may be overridden
+// with environment variable GOEVAL_PLAYGROUND.
+func endpoint() string {
+	if ep := os.Getenv("GOEVAL_PLAYGROUND"); ep != "" {
+		return strings.TrimSuffix(ep, "/")
+	}
+	return "https://play.golang.org"
+}
+
+func main() {
+	http.DefaultTransport = &uaTransport{rt: http.DefaultTransport, UserAgent: os.Args[1]}
+
+	// Accept URLs such as https://go.dev/play/p/<id> or https://play.golang.org/p/<id>.go
+	id := os.Args[2]
+	if u, err := url.Parse(id); err == nil && u.Host != "" {
+		id = path.Base(u.Path)
+	}
+	id = strings.TrimSuffix(id, ".go")
+
+	resp, err := http.Get(endpoint() + "/p/" + url.PathEscape(id) + ".go")
+	if err != nil {
+		log.Fatal("fetch: ", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("fetch: %s: %s", id, resp.Status)
+	}
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		log.Fatal("fetch: ", err)
+	}
+}
@@ -0,0 +1,32 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Command fmt is the sub command launched by "goeval -goimports=play".
+//
+// fmt sends the source code to the Go Playground at https://play.golang.org/fmt
+// with imports=true to fix imports and format the code like goimports does.
+//
+// The second argument (after the User-Agent) is the line of the snippet in the
+// source: it is used to report errors with positions relative to the snippet.
+//
+//	$ curl -s --data-urlencode body@- -d imports=true https://play.golang.org/fmt <<EOF
+//	package main
+//	func main() {
+//	  fmt.Println("Hello, world!")
+//	}
+//	EOF
+//	{"Body":"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"Hello, world!\")\n}\n","Error":""}
+package main
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type uaTransport struct {
+	rt        http.RoundTripper
+	UserAgent string
+}
+
+func (t *uaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", t.UserAgent)
+	return t.rt.RoundTrip(req)
+}
+
+// endpoint returns the base URL of the Go Playground, which may be overridden
+// with environment variable GOEVAL_PLAYGROUND.
+func endpoint() string {
+	if ep := os.Getenv("GOEVAL_PLAYGROUND"); ep != "" {
+		return strings.TrimSuffix(ep, "/")
+	}
+	return "https://play.golang.org"
+}
+
+// errorPos matches the position at the start of each line of an error message:
+//   - "prog.go:7:2: " (the usual case)
+//   - "1:2: " (source with a "//line :1" directive: already relative to the snippet)
+var errorPos = regexp.MustCompile(`(?m)^(prog\.go:)?(\d+)(:\d+)?: `)
+
+// snippetErrors rewrites the positions in the error message to be relative to the
+// snippet which starts at line codeLine of prog.go.
+func snippetErrors(msg string, codeLine int) string {
+	return errorPos.ReplaceAllStringFunc(msg, func(pos string) string {
+		m := errorPos.FindStringSubmatch(pos)
+		line, _ := strconv.Atoi(m[2])
+		if m[1] != "" {
+			if codeLine <= 0 || line < codeLine {
+				return pos
+			}
+			line = line - codeLine + 1
+		}
+		return ":" + strconv.Itoa(line) + m[3] + ": "
+	})
+}
+
+func main() {
+	http.DefaultTransport = &uaTransport{rt: http.DefaultTransport, UserAgent: os.Args[1]}
+	codeLine, _ := strconv.Atoi(os.Args[2])
+
+	code, _ := io.ReadAll(os.Stdin)
+	resp, err := http.PostForm(endpoint()+"/fmt", url.Values{"body": {string(code)}, "imports": {"true"}})
+	if err != nil {
+		log.Fatal("fmt: ", err)
+	}
+	defer resp.Body.Close()
+	var r struct {
+		Body  string
+		Error string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		log.Fatal("fmt: ", err)
+	}
+	if r.Error != "" {
+		io.WriteString(os.Stderr, strings.TrimSuffix(snippetErrors(r.Error, codeLine), "\n")+"\n")
+		os.Exit(1)
+	}
+	io.WriteString(os.Stdout, r.Body)
+}
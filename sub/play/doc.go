@@ -19,6 +19,12 @@
 // play sends the program code to the Go Playground at https://play.golang.org/compile
 // and replays the received events respecting event delays.
 //
+// With flag -vet (after the User-Agent argument), "go vet" is also run by the Go Playground
+// and the program output is not shown if vet reports problems.
+//
+// With flag -json, the response is written as JSON lines on stdout, without
+// replaying delays: vet errors, build errors, events, and finally the status.
+//
 //	$ curl -s -X POST --data-urlencode body@- https://play.golang.org/compile <<EOF
 //	package main
 //	import "fmt"
@@ -2,11 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -20,30 +22,81 @@ func (t *uaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return t.rt.RoundTrip(req)
 }
 
+// endpoint returns the base URL of the Go Playground, which may be overridden
+// with environment variable GOEVAL_PLAYGROUND.
+func endpoint() string {
+	if ep := os.Getenv("GOEVAL_PLAYGROUND"); ep != "" {
+		return strings.TrimSuffix(ep, "/")
+	}
+	return "https://play.golang.org"
+}
+
+// event is an output event from the Go Playground, and also a line of the -json output.
+// Kind is "stdout" or "stderr" for events, and for the -json output it may also be:
+//   - "vet": vet errors, in Message
+//   - "errors": build errors, in Message
+//   - "status": the last line, with the exit status of the program
+type event struct {
+	Kind        string
+	Message     string        `json:",omitempty"`
+	Delay       time.Duration `json:",omitempty"`
+	Status      *int          `json:",omitempty"`
+	IsTest      bool          `json:",omitempty"`
+	TestsFailed int           `json:",omitempty"`
+}
+
 func main() {
 	http.DefaultTransport = &uaTransport{rt: http.DefaultTransport, UserAgent: os.Args[1]}
 
+	withVet := flag.Bool("vet", false, "run go vet")
+	jsonOutput := flag.Bool("json", false, "output events as JSON lines, without replaying delays")
+	flag.CommandLine.Parse(os.Args[2:])
+
 	code, _ := io.ReadAll(os.Stdin)
-	resp, err := http.PostForm("https://play.golang.org/compile", url.Values{"body": {string(code)}})
+	form := url.Values{"body": {string(code)}}
+	if *withVet {
+		form.Set("withVet", "true")
+	}
+	resp, err := http.PostForm(endpoint()+"/compile", form)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer resp.Body.Close()
 	// resp.Body = io.NopCloser(io.TeeReader(resp.Body, os.Stdout)); // Enable for debugging
 	var r struct {
-		Errors string
-		Events []struct {
-			Delay   time.Duration
-			Message string
-			Kind    string
-		}
-		Status int
-		// IsTest      bool // unused
-		// TestsFailed int  // unused
+		Errors      string
+		Events      []event
+		Status      int
+		IsTest      bool
+		TestsFailed int
+		VetErrors   string
+		VetOK       bool
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		log.Fatal(err)
 	}
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		if r.VetErrors != "" {
+			enc.Encode(event{Kind: "vet", Message: r.VetErrors})
+		}
+		if r.Errors != "" {
+			enc.Encode(event{Kind: "errors", Message: r.Errors})
+		}
+		for _, ev := range r.Events {
+			enc.Encode(ev)
+		}
+		enc.Encode(event{Kind: "status", Status: &r.Status, IsTest: r.IsTest, TestsFailed: r.TestsFailed})
+		if r.VetErrors != "" {
+			os.Exit(1)
+		}
+		os.Exit(r.Status)
+	}
+	// Like local runs, don't show the output if vet fails
+	if r.VetErrors != "" {
+		io.WriteString(os.Stderr, r.VetErrors)
+		os.Exit(1)
+	}
 	if r.Errors != "" {
 		log.Print(r.Errors)
 	}
@@ -19,13 +19,30 @@
 package main_test
 
 import (
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"strings"
+	"testing"
+
+	"github.com/dolmen-go/goeval/internal/fakeplay"
 )
 
 const userAgent = "goeval.play.test/v0.0.0 (github.com/dolmen-go/goeval/sub/play_test)"
 
+// TestMain runs the tests against a local fake of the Go Playground,
+// unless GOEVAL_PLAYGROUND is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("GOEVAL_PLAYGROUND") != "" {
+		os.Exit(m.Run())
+	}
+	srv := httptest.NewServer(fakeplay.New())
+	os.Setenv("GOEVAL_PLAYGROUND", srv.URL)
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
 func Example_fmt() {
 	cmd := exec.Command("go", "run", "play.go", userAgent)
 	cmd.Env = append(os.Environ(), "GO111MODULE=off")
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 )
 
 type uaTransport struct {
@@ -17,10 +18,19 @@ func (t *uaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return t.rt.RoundTrip(req)
 }
 
+// endpoint returns the base URL of the Go Playground, which may be overridden
+// with environment variable GOEVAL_PLAYGROUND.
+func endpoint() string {
+	if ep := os.Getenv("GOEVAL_PLAYGROUND"); ep != "" {
+		return strings.TrimSuffix(ep, "/")
+	}
+	return "https://play.golang.org"
+}
+
 func main() {
 	http.DefaultTransport = &uaTransport{rt: http.DefaultTransport, UserAgent: os.Args[1]}
 
-	resp, err := http.Post("https://play.golang.org/share", "text/plain; charset=utf-8", os.Stdin)
+	resp, err := http.Post(endpoint()+"/share", "text/plain; charset=utf-8", os.Stdin)
 	if err != nil {
 		log.Fatal("share:", err)
 	}
@@ -29,5 +39,12 @@ func main() {
 	if err != nil {
 		log.Fatal("share:", err)
 	}
-	io.WriteString(os.Stdout, "https://go.dev/play/p/"+string(id)+"\n")
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("share: %s: %s", resp.Status, id)
+	}
+	if ep := endpoint(); ep != "https://play.golang.org" {
+		io.WriteString(os.Stdout, ep+"/p/"+string(id)+"\n")
+	} else {
+		io.WriteString(os.Stdout, "https://go.dev/play/p/"+string(id)+"\n")
+	}
 }
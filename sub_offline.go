@@ -20,26 +20,43 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
+	"io"
+
+	"github.com/dolmen-go/goeval/eval"
 )
 
 const featureIsDisabled = "feature is disabled in offline build"
 
+const playJSON = false
+
 // registerOnlineFlags does nothing.
 func registerOnlineFlags() {
 	flag.BoolFunc("play", featureIsDisabled+".", disabledFeature)
 	flag.BoolFunc("share", featureIsDisabled+".", disabledFeature)
+	flag.Func("fetch", featureIsDisabled+".", disabledFeature)
+	flag.Func("playground", featureIsDisabled+".", disabledFeature)
+	flag.BoolFunc("json", featureIsDisabled+".", disabledFeature)
 }
 
 func disabledFeature(string) error {
 	return errors.New(featureIsDisabled)
 }
 
-func prepareSubPlay() (*bytes.Buffer, func() error, func()) {
+func prepareSubPlay(context.Context, *eval.Options) (*bytes.Buffer, func() error, func()) {
 	panic("dead code in offline mode")
 }
 
-func prepareSubShare() (*bytes.Buffer, func() error, func()) {
+func prepareSubShare(context.Context, *eval.Options) (*bytes.Buffer, func() error, func()) {
+	panic("dead code in offline mode")
+}
+
+func playFmt(context.Context, *eval.Options, []byte, io.Writer, int) error {
+	return errors.New("-goimports=play: " + featureIsDisabled)
+}
+
+func fetchSnippet(context.Context, *eval.Options, string) ([]byte, error) {
 	panic("dead code in offline mode")
 }
@@ -0,0 +1,6 @@
+// Package greet is a module used to test the import of a module from a local directory.
+package greet
+
+func Hello(name string) string {
+	return "Hello, " + name + "!"
+}
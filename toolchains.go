@@ -0,0 +1,175 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	goversion "go/version"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/dolmen-go/goeval/eval"
+	"github.com/dolmen-go/goeval/internal/procgroup"
+)
+
+// With a comma-separated list of toolchains given to -go, goeval runs itself once for each
+// toolchain, with the same arguments, and reports the outputs, exit codes and timings.
+// Each toolchain is either a go command (found in PATH, such as the golang.org/dl wrappers
+// go1.22.12 or gotip) or the name of a Go toolchain selected with GOTOOLCHAIN.
+
+// toolchainEnv is the environment variable that gives the go command to each run of a
+// comparison of toolchains. It overrides -go, even if set by a script directive.
+const toolchainEnv = "GOEVAL_TOOLCHAIN"
+
+// A toolchain is a Go toolchain to compare.
+type toolchain struct {
+	name  string   // as given to -go
+	goCmd string   // go command
+	env   []string // additional environment variables
+}
+
+// resolveToolchain returns the go command and environment for a toolchain given to -go.
+func resolveToolchain(name string) (toolchain, error) {
+	tc := toolchain{name: name}
+	cmd := name
+	if cmd == "tip" {
+		cmd = "gotip" // golang.org/dl/gotip
+	}
+	if path, err := exec.LookPath(cmd); err == nil {
+		tc.goCmd = path
+		return tc, nil
+	}
+	if !goversion.IsValid(name) {
+		return tc, fmt.Errorf("-go %s: not a go command in PATH or a Go toolchain name", name)
+	}
+	// GOTOOLCHAIN only selects toolchains since Go 1.21
+	if goversion.Compare(goversion.Lang(name), "go1.21") < 0 {
+		return tc, fmt.Errorf("-go %s: Go toolchains before go1.21 can't be selected with GOTOOLCHAIN: install the golang.org/dl/%s wrapper in PATH", name, name)
+	}
+	// Since Go 1.21, the first release of a language version is go1.N.0
+	if goversion.Lang(name) == name && goversion.Compare(name, "go1.21") >= 0 {
+		name += ".0"
+	}
+	tc.goCmd = "go"
+	tc.env = []string{"GOTOOLCHAIN=" + name}
+	return tc, nil
+}
+
+// toolchainVersion returns the GOVERSION of a toolchain. The toolchain is downloaded if
+// necessary (GOTOOLCHAIN).
+func toolchainVersion(ctx context.Context, opts *eval.Options, goCmd string, env []string) (string, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout, "resolve")
+	defer cancel()
+	var out bytes.Buffer
+	cmd := procgroup.Command(ctx, goCmd, "env", "GOVERSION")
+	cmd.Env = env
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := runCmd(opts, cmd); err != nil {
+		if ctx.Err() != nil {
+			return "", context.Cause(ctx)
+		}
+		return "", err
+	}
+	return string(bytes.TrimRight(out.Bytes(), "\r\n")), nil
+}
+
+// A toolchainResult is the result of a run with a toolchain.
+type toolchainResult struct {
+	version  string       // GOVERSION
+	output   bytes.Buffer // stdout and stderr
+	exitCode int
+	duration time.Duration
+}
+
+// compareToolchains runs goeval with args for each toolchain and reports the results on stdout.
+// stdin is given to each run. An error is returned if the results differ.
+// opts.Timeout (-timeout) limits "go env GOVERSION", which may download the toolchain. The runs
+// apply -timeout themselves.
+func compareToolchains(ctx context.Context, opts *eval.Options, names []string, args []string, stdin []byte) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	toolchains := make([]toolchain, len(names))
+	for i, name := range names {
+		if toolchains[i], err = resolveToolchain(name); err != nil {
+			return err
+		}
+	}
+
+	results := make([]toolchainResult, len(toolchains))
+	for i, tc := range toolchains {
+		env := append(os.Environ(), tc.env...)
+
+		version, err := toolchainVersion(ctx, opts, tc.goCmd, env)
+		if err != nil {
+			return fmt.Errorf("-go %s: %w", tc.name, err)
+		}
+		results[i].version = version
+
+		cmd := exec.CommandContext(ctx, self, args...)
+		cmd.Env = append(env, toolchainEnv+"="+tc.goCmd)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = &results[i].output
+		cmd.Stderr = &results[i].output
+		procgroup.Set(ctx, cmd)
+		start := time.Now()
+		err = runCmd(opts, cmd)
+		results[i].duration = time.Since(start)
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && ctx.Err() == nil {
+			results[i].exitCode = exit.ExitCode()
+		} else if err != nil {
+			return fmt.Errorf("-go %s: %w", tc.name, err)
+		}
+	}
+
+	var differ bool
+	for i := range results {
+		r := &results[i]
+		header := fmt.Sprintf("=== %s (%s): exit %d, %v", toolchains[i].name, r.version, r.exitCode, r.duration.Round(time.Millisecond))
+		same := -1
+		for j := range i {
+			if bytes.Equal(results[j].output.Bytes(), r.output.Bytes()) {
+				same = j
+				break
+			}
+		}
+		differ = differ || r.exitCode != results[0].exitCode || same != 0 && i > 0
+		if same >= 0 {
+			fmt.Printf("%s, same output as %s\n", header, toolchains[same].name)
+			continue
+		}
+		fmt.Println(header)
+		out := r.output.Bytes()
+		os.Stdout.Write(out)
+		if len(out) > 0 && out[len(out)-1] != '\n' {
+			io.WriteString(os.Stdout, "\n")
+		}
+	}
+	if differ {
+		return errors.New("results differ between toolchains")
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolveToolchain(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		goCmd string
+		env   []string
+	}{
+		{"go1.22", "go", []string{"GOTOOLCHAIN=go1.22.0"}},
+		{"go1.22.3", "go", []string{"GOTOOLCHAIN=go1.22.3"}},
+		{"go1.23rc1", "go", []string{"GOTOOLCHAIN=go1.23rc1"}},
+	} {
+		got, err := resolveToolchain(tc.name)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got.goCmd != tc.goCmd || !slices.Equal(got.env, tc.env) {
+			t.Errorf("%s: got %q %q", tc.name, got.goCmd, got.env)
+		}
+	}
+
+	for _, name := range []string{"not-a-toolchain", "go1.20", "go1.20.14"} {
+		if _, err := resolveToolchain(name); err == nil {
+			t.Errorf("%s: error expected", name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+   Copyright 2026 Olivier Mengué.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/txtar"
+
+	"github.com/dolmen-go/goeval/eval"
+)
+
+// mainFile is the name of the Go source that precedes the first file marker
+// in a txtar archive. This is the convention of the Go Playground.
+const mainFile = "prog.go"
+
+// readArchive reads a txtar archive for -txtar. "-" is stdin.
+func readArchive(name string) (*txtar.Archive, error) {
+	var b []byte
+	var err error
+	if name == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseArchive(b)
+}
+
+// parseArchive parses a txtar archive with the conventions of the Go Playground:
+// the archive comment, if not blank, is the Go source file [mainFile].
+// So plain Go source is also accepted as an archive of a single file.
+func parseArchive(b []byte) (*txtar.Archive, error) {
+	ar := txtar.Parse(b)
+	if len(bytes.TrimSpace(ar.Comment)) > 0 {
+		ar.Files = append([]txtar.File{{Name: mainFile, Data: ar.Comment}}, ar.Files...)
+	}
+	ar.Comment = nil
+	if len(ar.Files) == 0 {
+		return nil, errors.New("empty archive")
+	}
+	for _, f := range ar.Files {
+		if !filepath.IsLocal(f.Name) {
+			return nil, fmt.Errorf("%q: invalid file name in archive", f.Name)
+		}
+	}
+	return ar, nil
+}
+
+// formatArchive is the reverse of [parseArchive].
+func formatArchive(ar *txtar.Archive) []byte {
+	if ar.Files[0].Name == mainFile {
+		ar = &txtar.Archive{
+			Comment: ar.Files[0].Data,
+			Files:   ar.Files[1:],
+		}
+	}
+	return txtar.Format(ar)
+}
+
+// runArchive applies the action to the program contained in the archive.
+func runArchive(ctx context.Context, ar *txtar.Archive, opts *eval.Options) error {
+	switch action {
+	case actionRun, actionBuild:
+		p, err := eval.FromArchive(ctx, ar, opts)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+
+		if action == actionBuild {
+			return p.Build(ctx, buildOutput)
+		}
+		res, err := p.Run(ctx)
+		if err != nil {
+			return err
+		}
+		return exitStatus(res)
+	case actionPlay:
+		if len(opts.Args) > 0 {
+			return errors.New("arguments are not supported with -play and an archive")
+		}
+		ctx, cancel := withTimeout(ctx, opts.Timeout, "run")
+		defer cancel()
+		stdin, tail, cleanup := prepareSubPlay(ctx, opts)
+		defer cleanup()
+		stdin.Write(formatArchive(ar))
+		return tail()
+	case actionShare:
+		ctx, cancel := withTimeout(ctx, opts.Timeout, "run")
+		defer cancel()
+		stdin, tail, cleanup := prepareSubShare(ctx, opts)
+		defer cleanup()
+		stdin.Write(formatArchive(ar))
+		return tail()
+	default: // actionDump, actionDumpPlay
+		_, err := os.Stdout.Write(formatArchive(ar))
+		return err
+	}
+}